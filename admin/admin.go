@@ -0,0 +1,339 @@
+// Package admin serves the stats and the items of the live caches over
+// HTTP/JSON, for debugging them in production.
+//
+// The routes, relative to where the Handler is mounted, are:
+//
+//	GET    /                      names of the caches
+//	GET    /{cache}/stats         stats
+//	GET    /{cache}/config        config (only for inmemory)
+//	GET    /{cache}/item?key=...  value and metadata of the key
+//	DELETE /{cache}/item?key=...  deletes the key
+//	POST   /{cache}/flush         deletes all the keys
+//
+// The stats and the config of a hafezieh.Wrapper, like a namespace, are the
+// ones of the wrapped inmemory cache.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+var (
+	// ErrUnauthorized is returned by the AuthFuncs, when the credentials are
+	// missing or wrong
+	ErrUnauthorized = errors.New("Unauthorized")
+)
+
+// AuthFunc checks a request, and returns an error if it's not allowed
+type AuthFunc func(r *http.Request) error
+
+// TokenAuth allows the requests with "Authorization: Bearer <token>"
+func TokenAuth(token string) AuthFunc {
+	return func(r *http.Request) error {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return ErrUnauthorized
+		}
+		return nil
+	}
+}
+
+// BasicAuth allows the requests with the HTTP basic authentication
+func BasicAuth(username, password string) AuthFunc {
+	return func(r *http.Request) error {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			return ErrUnauthorized
+		}
+		return nil
+	}
+}
+
+// Handler serves the named caches
+type Handler struct {
+	auth AuthFunc
+
+	mutex  sync.RWMutex
+	caches map[string]hafezieh.Cache
+}
+
+// NewHandler returns a Handler which checks all the requests by auth. A nil
+// auth allows everyone, so the Handler should be protected otherwise.
+func NewHandler(auth AuthFunc) *Handler {
+	return &Handler{auth: auth, caches: make(map[string]hafezieh.Cache)}
+}
+
+// Add serves the cache by the name
+func (h *Handler) Add(name string, cache hafezieh.Cache) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.caches[name] = cache
+}
+
+// Remove stops serving the cache of the name
+func (h *Handler) Remove(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.caches, name)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil {
+		if err := h.auth(r); err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		if !allowMethod(w, r, "GET") {
+			return
+		}
+		writeJSON(w, http.StatusOK, h.names())
+		return
+	}
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	h.mutex.RLock()
+	cache, found := h.caches[parts[0]]
+	h.mutex.RUnlock()
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown cache: %q", parts[0]))
+		return
+	}
+
+	switch parts[1] {
+	case "stats":
+		if allowMethod(w, r, "GET") {
+			serveStats(w, cache)
+		}
+	case "config":
+		if allowMethod(w, r, "GET") {
+			serveConfig(w, cache)
+		}
+	case "item":
+		if allowMethod(w, r, "GET", "DELETE") {
+			serveItem(w, r, cache)
+		}
+	case "flush":
+		if allowMethod(w, r, "POST") {
+			serveFlush(w, cache)
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) names() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	names := make([]string, 0, len(h.caches))
+	for name := range h.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// inMemory returns the InMemoryCache under the wrappers of cache, if any
+func inMemory(cache hafezieh.Cache) (*inmemory.InMemoryCache, bool) {
+	for {
+		switch c := cache.(type) {
+		case *inmemory.InMemoryCache:
+			return c, true
+		case hafezieh.Wrapper:
+			cache = c.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+func serveStats(w http.ResponseWriter, cache hafezieh.Cache) {
+	if c, ok := inMemory(cache); ok {
+		writeJSON(w, http.StatusOK, c.Stats())
+		return
+	}
+	if c, ok := cache.(hafezieh.SizedCache); ok {
+		writeJSON(w, http.StatusOK, map[string]int{"Items": c.Len()})
+		return
+	}
+	writeError(w, http.StatusNotImplemented, hafezieh.ErrNotSupported)
+}
+
+// cleanupConfig is the JSON view of inmemory.InMemoryCleanupConfig, without
+// the functions
+type cleanupConfig struct {
+	Mechanism           inmemory.CleanupMechanism
+	Clock               string
+	HeapTarget          hafezieh.ByteSize
+	NumberOfItemsTarget uint64
+	Percent             float64
+	NamespaceQuotas     map[string]uint64 `json:",omitempty"`
+}
+
+type cacheConfig struct {
+	Name                        string `json:",omitempty"`
+	RevisitDefaultDuration      string
+	RevisitNumberOfWorkers      int
+	RevisitClock                string
+	RevisitDrainOnClose         bool
+	NegativeDefaultDuration     string
+	NegativeNumberOfItemsTarget int
+	Cleanup                     *cleanupConfig `json:",omitempty"`
+}
+
+func serveConfig(w http.ResponseWriter, cache hafezieh.Cache) {
+	c, ok := inMemory(cache)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, hafezieh.ErrNotSupported)
+		return
+	}
+	config := c.Config()
+	view := &cacheConfig{
+		Name:                        config.Name,
+		RevisitDefaultDuration:      config.RevisitDefaultDuration.String(),
+		RevisitNumberOfWorkers:      config.RevisitNumberOfWorkers,
+		RevisitClock:                config.RevisitClock.String(),
+		RevisitDrainOnClose:         config.RevisitDrainOnClose,
+		NegativeDefaultDuration:     config.NegativeDefaultDuration.String(),
+		NegativeNumberOfItemsTarget: config.NegativeNumberOfItemsTarget,
+	}
+	if config.Cleanup != nil {
+		view.Cleanup = &cleanupConfig{
+			Mechanism:           config.Cleanup.Mechanism,
+			Clock:               config.Cleanup.Clock.String(),
+			HeapTarget:          config.Cleanup.HeapTarget,
+			NumberOfItemsTarget: config.Cleanup.NumberOfItemsTarget,
+			Percent:             config.Cleanup.Percent,
+			NamespaceQuotas:     config.Cleanup.NamespaceQuotas,
+		}
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+type itemView struct {
+	Key         string
+	Value       interface{}
+	CreatedAt   *time.Time `json:",omitempty"`
+	LastAccess  *time.Time `json:",omitempty"`
+	Hits        *uint      `json:",omitempty"`
+	RevisitTime *time.Time `json:",omitempty"`
+	Tags        []string   `json:",omitempty"`
+	Negative    bool       `json:",omitempty"`
+	Error       string     `json:",omitempty"`
+	ExpiresAt   *time.Time `json:",omitempty"`
+}
+
+func serveItem(w http.ResponseWriter, r *http.Request, cache hafezieh.Cache) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errors.New("no key"))
+		return
+	}
+	if r.Method == "DELETE" {
+		if err := cache.Del(key); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	view := &itemView{Key: key}
+	if c, ok := cache.(*inmemory.InMemoryCache); ok {
+		// Inspect doesn't count as an access
+		item, err := c.Inspect(key)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+		view.Value = jsonValue(item.Item)
+		view.CreatedAt, view.LastAccess, view.Hits = &item.CreatedAt, &item.LastAccess, &item.Hits
+		if revisitTime, ok := item.RevisitTime(); ok {
+			view.RevisitTime = &revisitTime
+		}
+		view.Tags = item.Tags()
+		if negative, err := item.Negative(); negative {
+			view.Negative, view.Error = true, err.Error()
+			if expiresAt := item.ExpiresAt(); !expiresAt.IsZero() {
+				view.ExpiresAt = &expiresAt
+			}
+		}
+	} else {
+		x, err := cache.Get(key)
+		if err != nil {
+			writeCacheError(w, err)
+			return
+		}
+		view.Value = jsonValue(x)
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// jsonValue returns x, or its %v format if it can't be encoded to JSON
+func jsonValue(x interface{}) interface{} {
+	if _, err := json.Marshal(x); err != nil {
+		return fmt.Sprintf("%v", x)
+	}
+	return x
+}
+
+func serveFlush(w http.ResponseWriter, cache hafezieh.Cache) {
+	flusher, ok := cache.(hafezieh.Flusher)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, hafezieh.ErrNotSupported)
+		return
+	}
+	if err := flusher.Flush(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func writeCacheError(w http.ResponseWriter, err error) {
+	if err == hafezieh.ErrMiss {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/dummy"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+func request(t *testing.T, h http.Handler, method, path string, out interface{}) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v: %q", method, path, err, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func TestHandler(t *testing.T) {
+	cache, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		Cleanup: &inmemory.InMemoryCleanupConfig{
+			Mechanism:  inmemory.CleanupHeapBasedLRU,
+			HeapTarget: 512 * 1000 * 1000,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	cache.Set("user:1", map[string]string{"name": "hafez"}, time.Minute)
+	cache.Get("user:1")
+
+	h := NewHandler(TokenAuth("secret"))
+	h.Add("users", cache)
+	h.Add("dummy", dummy.NewDummyCache())
+
+	var names []string
+	if code := request(t, h, "GET", "/", &names); code != http.StatusOK || len(names) != 2 || names[0] != "dummy" {
+		t.Fatal("unexpected names:", code, names)
+	}
+
+	var stats inmemory.InMemoryCacheStats
+	if code := request(t, h, "GET", "/users/stats", &stats); code != http.StatusOK ||
+		stats.Items != 1 || stats.Hits != 1 || stats.ScheduledRevisits != 1 {
+		t.Fatalf("unexpected stats: %d %+v", code, stats)
+	}
+
+	var config map[string]interface{}
+	if code := request(t, h, "GET", "/users/config", &config); code != http.StatusOK {
+		t.Fatal("unexpected status:", code)
+	}
+	cleanup := config["Cleanup"].(map[string]interface{})
+	if cleanup["Mechanism"] != "heap-lru" || cleanup["HeapTarget"] != "512000000" || cleanup["Clock"] != "1m0s" {
+		t.Fatal("unexpected cleanup config:", cleanup)
+	}
+
+	// The stats of the wrapped cache
+	h.Add("billing", hafezieh.Namespace(cache, "billing"))
+	stats = inmemory.InMemoryCacheStats{}
+	if code := request(t, h, "GET", "/billing/stats", &stats); code != http.StatusOK || stats.Items != 1 {
+		t.Fatalf("unexpected stats of the namespace: %d %+v", code, stats)
+	}
+	h.Remove("billing")
+
+	var item map[string]interface{}
+	if code := request(t, h, "GET", "/users/item?key=user:1", &item); code != http.StatusOK {
+		t.Fatal("unexpected status:", code, item)
+	}
+	if item["Value"].(map[string]interface{})["name"] != "hafez" || item["Hits"] != 1.0 || item["RevisitTime"] == nil {
+		t.Fatal("unexpected item:", item)
+	}
+	if code := request(t, h, "GET", "/users/item?key=user:2", nil); code != http.StatusNotFound {
+		t.Fatal("unexpected status of a miss:", code)
+	}
+	if code := request(t, h, "GET", "/dummy/item?key=user:1", nil); code != http.StatusNotFound {
+		t.Fatal("unexpected status of a miss:", code)
+	}
+
+	if code := request(t, h, "DELETE", "/users/item?key=user:1", nil); code != http.StatusNoContent {
+		t.Fatal("unexpected status:", code)
+	}
+	if _, err := cache.Get("user:1"); err != hafezieh.ErrMiss {
+		t.Fatal("the key isn't deleted:", err)
+	}
+
+	cache.Set("user:3", 3, 0)
+	if code := request(t, h, "GET", "/users/flush", nil); code != http.StatusMethodNotAllowed {
+		t.Fatal("unexpected status:", code)
+	}
+	if code := request(t, h, "POST", "/users/flush", nil); code != http.StatusNoContent {
+		t.Fatal("unexpected status:", code)
+	}
+	if _, err := cache.Get("user:3"); err != hafezieh.ErrMiss {
+		t.Fatal("the cache isn't flushed:", err)
+	}
+	if code := request(t, h, "GET", "/unknown/stats", nil); code != http.StatusNotFound {
+		t.Fatal("unexpected status:", code)
+	}
+	if code := request(t, h, "GET", "/dummy/config", nil); code != http.StatusNotImplemented {
+		t.Fatal("unexpected status:", code)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	h := NewHandler(BasicAuth("admin", "pass"))
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatal("unexpected status without credentials:", w.Code)
+	}
+
+	req.SetBasicAuth("admin", "pass")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal("unexpected status with credentials:", w.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package hafezieh
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]ByteSize{
+		"1024":    1024,
+		"10B":     10,
+		"2k":      2048,
+		"2KB":     2000,
+		"512MiB":  512 << 20,
+		"1.5 GiB": 3 << 29,
+		"1tb":     1e12,
+	}
+	for s, expected := range tests {
+		size, err := ParseByteSize(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != expected {
+			t.Fatalf("unexpected size for %q: %d != %d", s, size, expected)
+		}
+	}
+	for _, s := range []string{"", "MB", "12XB", "1.2.3K"} {
+		if _, err := ParseByteSize(s); err == nil {
+			t.Fatalf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	var errs ValidationErrors
+	if errs.Err() != nil {
+		t.Fatal("expected nil for no errors")
+	}
+	errs = errs.Append(nil)
+	errs = errs.Append(errors.New("a"))
+	errs = errs.Append(ValidationErrors{errors.New("b"), errors.New("c")})
+	if err := errs.Err(); err == nil || err.Error() != "a; b; c" {
+		t.Fatal("unexpected error:", err)
+	}
+}
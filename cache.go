@@ -14,6 +14,19 @@ var (
 	ErrMiss = errors.New("Not cached, or deleted")
 	// ErrNegativeDuration is the error returned on Set, when revisitDuration<0
 	ErrNegativeDuration = errors.New("revisitDuration can't be negative")
+	// ErrExists is the error returned on Add, when the key is available
+	ErrExists = errors.New("Already cached")
+	// ErrCASConflict is the error returned on CompareAndSwap, when the item is
+	// modified or deleted after its cas token is taken
+	ErrCASConflict = errors.New("Modified after the cas token is taken")
+	// ErrNotNumeric is the error returned on Incr and Decr, when the value of
+	// the key is not an integer
+	ErrNotNumeric = errors.New("Not an integer value")
+	// ErrClosed is the error returned by the methods of a closed cache
+	ErrClosed = errors.New("Cache is closed")
+	// ErrNotSupported is the error returned by an optional operation, when
+	// the engine doesn't support it
+	ErrNotSupported = errors.New("Not supported by the engine")
 )
 
 // Cache is a simple cache interface, to rulw all the cache engunes
@@ -31,6 +44,114 @@ type Cache interface {
 	// Deletes the assigned objected
 	Del(key string) error
 
-	// Close frees the resources
+	// Close frees the resources. It can be called more than once, and the
+	// other methods may return ErrClosed after it.
 	Close() error
 }
+
+// AtomicCache is implemented by the engines which support conditional and
+// atomic updates, to prevent lost updates of Get followed by Set
+type AtomicCache interface {
+	Cache
+
+	// Add stores x only if the key is not available, otherwise ErrExists is
+	// returned
+	Add(key string, x interface{}, revisitDuration time.Duration) error
+
+	// Replace stores x only if the key is available, otherwise ErrMiss is
+	// returned
+	Replace(key string, x interface{}, revisitDuration time.Duration) error
+
+	// Gets is like Get, but also returns a cas token of the item, to be used
+	// in CompareAndSwap
+	Gets(key string) (interface{}, uint64, error)
+
+	// CompareAndSwap stores x only if the item is not changed since its cas
+	// token is taken by Gets, otherwise ErrCASConflict is returned
+	CompareAndSwap(key string, x interface{}, cas uint64, revisitDuration time.Duration) error
+
+	// Update calls fn with the current value of the key (nil if it's not
+	// available) and stores its result, atomically. Nothing is stored if fn
+	// returns an error, and the error is returned. The revisit of an available
+	// key is kept, and a new key is set with the default revisitDuration.
+	Update(key string, fn func(old interface{}) (interface{}, error)) error
+}
+
+// CounterCache is implemented by the engines which support atomic counters
+type CounterCache interface {
+	Cache
+
+	// Incr adds delta to the integer value of the key, and returns the result.
+	// A key which is not available is set to delta, with the default
+	// revisitDuration. The revisit of an available key is kept.
+	Incr(key string, delta int64) (int64, error)
+
+	// Decr is like Incr, but subtracts delta
+	Decr(key string, delta int64) (int64, error)
+}
+
+// TagInvalidator is implemented by the engines which can delete the keys by
+// the tags attached to them
+type TagInvalidator interface {
+	Cache
+
+	// SetWithTags is like Set, and attaches the tags to the key
+	SetWithTags(key string, x interface{}, revisitDuration time.Duration, tags ...string) error
+
+	// InvalidateTag deletes the keys which have the tag, and returns the
+	// number of deleted keys
+	InvalidateTag(tag string) (int, error)
+}
+
+// PrefixDeleter is implemented by the engines which can delete the keys by
+// their prefix
+type PrefixDeleter interface {
+	Cache
+
+	// DelPrefix deletes the keys starting with prefix, and returns the number
+	// of deleted keys
+	DelPrefix(prefix string) (int, error)
+}
+
+// KeyLister is implemented by the engines which can enumerate their keys
+type KeyLister interface {
+	Cache
+
+	// Keys returns the available keys starting with prefix, sorted
+	Keys(prefix string) ([]string, error)
+}
+
+// SizedCache is implemented by the engines which can report their size
+type SizedCache interface {
+	Cache
+
+	// Len returns the number of the available keys
+	Len() int
+}
+
+// Flusher is implemented by the engines which can delete all the keys at once
+type Flusher interface {
+	Cache
+
+	// Flush deletes all the keys
+	Flush() error
+}
+
+// NegativeCache is implemented by the engines which can remember the misses
+// and the errors, e.g. of a loader
+type NegativeCache interface {
+	Cache
+
+	// SetNegative makes Get return err (ErrMiss if it's nil) for the key, until
+	// ttl passes (0 means forever), or the key is reset or deleted
+	SetNegative(key string, err error, ttl time.Duration) error
+}
+
+// Wrapper is implemented by the decorators of the other caches, like
+// Namespace, middleware and otel
+type Wrapper interface {
+	Cache
+
+	// Unwrap returns the decorated cache
+	Unwrap() Cache
+}
@@ -0,0 +1,349 @@
+// Package cluster pools the memory of a set of processes, groupcache style.
+// Each node owns a shard of the keys by a consistent hash ring, and forwards
+// the calls of the other keys to their owners over HTTP. The values fetched
+// from the other nodes are kept for a while in a small local hot cache.
+package cluster
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+var (
+	// ErrNoSelf is returned by New, when Config.Self is not set
+	ErrNoSelf = errors.New("No Self is set")
+	// ErrValueTooLarge is returned by Get, when the value of the owner is
+	// larger than Config.MaxValueSize
+	ErrValueTooLarge = errors.New("Value is too large")
+
+	errWrongSecret = errors.New("Wrong secret")
+)
+
+// secretHeader carries Config.Secret
+const secretHeader = "X-Hafezieh-Secret"
+
+// hotItem is a copy of a value of another node. It's not returned after
+// Expires, even if the hot cache hasn't deleted it yet.
+type hotItem struct {
+	X       interface{}
+	Expires time.Time
+}
+
+// Config of a node
+type Config struct {
+	// Self is the base URL of this node, like "http://10.0.0.1:8080", which
+	// must be one of Peers
+	Self string `mapstructure:"self"`
+	// Peers are the base URLs of all the nodes. It can be changed by SetPeers.
+	Peers []string `mapstructure:"peers"`
+	// BasePath is where the nodes serve each other. Default: "/_hafezieh/"
+	BasePath string `mapstructure:"base-path"`
+	// Replicas is the number of the points of each node on the ring.
+	// Default: 50
+	Replicas int `mapstructure:"replicas"`
+	// HotNumberOfItemsTarget is the size of the hot cache. 0 disables it.
+	HotNumberOfItemsTarget uint64 `mapstructure:"hot-number-target"`
+	// HotDuration is how long the hot copies are kept. Default: 1 minute
+	HotDuration time.Duration `mapstructure:"hot-duration"`
+	// Timeout of the calls to the other nodes. Default: 5 seconds
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// MaxValueSize is the size of the largest encoded value which is
+	// accepted from the other nodes, both in their Sets and in the responses
+	// to Get. Default: 64MiB
+	MaxValueSize hafezieh.ByteSize `mapstructure:"max-value-size"`
+	// Secret, if set, is sent by the nodes to each other, and the requests
+	// without it are rejected. Without a Secret or Authorize, BasePath must
+	// not be reachable by the untrusted clients, since it lets them set and
+	// delete any key.
+	Secret string `mapstructure:"secret"`
+	// Authorize, if set, checks the requests of the other nodes, after
+	// Secret. The rejected requests get 403.
+	Authorize func(r *http.Request) error
+
+	// Codec of the values. Default: hafezieh.GobCodec
+	Codec hafezieh.Codec
+	// Client calls the other nodes. Default: a client with Timeout
+	Client *http.Client
+}
+
+func (config *Config) validateAndSetDefaults() error {
+	var errs hafezieh.ValidationErrors
+	if config.Self == "" {
+		errs = errs.Append(ErrNoSelf)
+	}
+	if config.BasePath == "" {
+		config.BasePath = "/_hafezieh/"
+	}
+	if config.Replicas == 0 {
+		config.Replicas = 50
+	} else if config.Replicas < 0 {
+		errs = errs.Append(errors.New("Replicas can't be negative"))
+	}
+	if config.HotDuration == 0 {
+		config.HotDuration = time.Minute
+	} else if config.HotDuration < 5*time.Second {
+		errs = errs.Append(errors.New("HotDuration should be at least 5 seconds"))
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.MaxValueSize == 0 {
+		config.MaxValueSize = 64 << 20
+	}
+	if config.Codec == nil {
+		config.Codec = hafezieh.GobCodec
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+	return errs.Err()
+}
+
+// Validate sets the defaults, and returns all the problems of the config as
+// a hafezieh.ValidationErrors
+func (config *Config) Validate() error {
+	return config.validateAndSetDefaults()
+}
+
+// Cache is a node of the cluster. It's also the http.Handler which should be
+// served on Config.BasePath, for the other nodes only, see Config.Secret.
+type Cache struct {
+	config *Config
+	local  hafezieh.Cache
+	hot    hafezieh.Cache
+
+	mutex sync.RWMutex
+	ring  *ring
+}
+
+// New returns a node, which stores its own shard in local. Closing the node
+// closes local too.
+func New(config *Config, local hafezieh.Cache) (*Cache, error) {
+	if err := config.validateAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	c := &Cache{config: config, local: local}
+	if config.HotNumberOfItemsTarget > 0 {
+		hot, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{
+			RevisitDefaultDuration: config.HotDuration,
+			RevisitNumberOfWorkers: 1,
+			RevisitFunc:            inmemory.ExpireRevisitFunc,
+			Cleanup: &inmemory.InMemoryCleanupConfig{
+				Mechanism:           inmemory.CleanupNumberBasedLRU,
+				NumberOfItemsTarget: config.HotNumberOfItemsTarget,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.hot = hot
+	}
+	c.SetPeers(config.Peers...)
+	return c, nil
+}
+
+// SetPeers replaces the nodes of the ring. Self is always on the ring.
+func (c *Cache) SetPeers(peers ...string) {
+	nodes := []string{c.config.Self}
+	for _, peer := range peers {
+		if peer != c.config.Self {
+			nodes = append(nodes, peer)
+		}
+	}
+	r := newRing(c.config.Replicas, nodes...)
+	c.mutex.Lock()
+	c.ring = r
+	c.mutex.Unlock()
+}
+
+// Owner returns the base URL of the owner of the key
+func (c *Cache) Owner(key string) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.ring.get(key)
+}
+
+func (c *Cache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	owner := c.Owner(key)
+	if owner == c.config.Self {
+		return c.local.Set(key, x, revisitDuration)
+	}
+	data, err := c.config.Codec.Encode(x)
+	if err != nil {
+		return err
+	}
+	if c.hot != nil {
+		c.hot.Del(key)
+	}
+	header := http.Header{}
+	header.Set("X-Revisit-Duration", strconv.FormatInt(int64(revisitDuration), 10))
+	_, err = c.call(owner, "PUT", key, header, data)
+	return err
+}
+
+func (c *Cache) Get(key string) (interface{}, error) {
+	owner := c.Owner(key)
+	if owner == c.config.Self {
+		return c.local.Get(key)
+	}
+	if c.hot != nil {
+		if x, err := c.hot.Get(key); err == nil {
+			if item, ok := x.(hotItem); ok && time.Now().Before(item.Expires) {
+				return item.X, nil
+			}
+		}
+	}
+	data, err := c.call(owner, "GET", key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	x, err := c.config.Codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.hot != nil {
+		c.hot.Set(key, hotItem{X: x, Expires: time.Now().Add(c.config.HotDuration)}, hafezieh.UseDefaultValue)
+	}
+	return x, nil
+}
+
+func (c *Cache) Del(key string) error {
+	owner := c.Owner(key)
+	if owner == c.config.Self {
+		return c.local.Del(key)
+	}
+	if c.hot != nil {
+		c.hot.Del(key)
+	}
+	_, err := c.call(owner, "DELETE", key, nil, nil)
+	return err
+}
+
+// Close closes the local and the hot caches
+func (c *Cache) Close() error {
+	if c.hot != nil {
+		c.hot.Close()
+	}
+	return c.local.Close()
+}
+
+// call sends a request of the key to the owner, and returns the body of the
+// response. 404 means hafezieh.ErrMiss.
+func (c *Cache) call(owner, method, key string, header http.Header, body []byte) ([]byte, error) {
+	u := strings.TrimSuffix(owner, "/") + c.config.BasePath + "?" + url.Values{"key": {key}}.Encode()
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.config.Secret != "" {
+		req.Header.Set(secretHeader, c.config.Secret)
+	}
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(c.config.MaxValueSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > int64(c.config.MaxValueSize) {
+		return nil, ErrValueTooLarge
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, hafezieh.ErrMiss
+	}
+	return nil, fmt.Errorf("cluster: %s %s: %s: %s", method, owner, resp.Status, bytes.TrimSpace(data))
+}
+
+// authorize checks the request by Config.Secret and Config.Authorize
+func (c *Cache) authorize(r *http.Request) error {
+	if c.config.Secret != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), []byte(c.config.Secret)) != 1 {
+		return errWrongSecret
+	}
+	if c.config.Authorize != nil {
+		return c.config.Authorize(r)
+	}
+	return nil
+}
+
+// ServeHTTP serves the calls of the other nodes, on the local cache
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := c.authorize(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "no key", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		x, err := c.local.Get(key)
+		if err == hafezieh.ErrMiss {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := c.config.Codec.Encode(x)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	case "PUT":
+		revisitDuration, err := strconv.ParseInt(r.Header.Get("X-Revisit-Duration"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid X-Revisit-Duration", http.StatusBadRequest)
+			return
+		}
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(c.config.MaxValueSize)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		x, err := c.config.Codec.Decode(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.local.Set(key, x, time.Duration(revisitDuration)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if err := c.local.Del(key); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
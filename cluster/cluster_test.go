@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(50, "a", "b", "c")
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprint("key:", i)
+		owners[key] = r.get(key)
+		counts[owners[key]]++
+	}
+	for node, count := range counts {
+		if count < 500 {
+			t.Fatalf("unbalanced ring, %s owns %d keys: %v", node, count, counts)
+		}
+	}
+
+	r = newRing(50, "a", "b", "c", "d")
+	for key, owner := range owners {
+		if newOwner := r.get(key); newOwner != owner && newOwner != "d" {
+			t.Fatalf("%s moved from %s to %s, instead of the new node", key, owner, newOwner)
+		}
+	}
+
+	if newRing(50).get("key") != "" {
+		t.Fatal("unexpected owner on an empty ring")
+	}
+}
+
+type testNode struct {
+	*Cache
+	local  *inmemory.InMemoryCache
+	server *httptest.Server
+}
+
+func newTestCluster(t *testing.T, n int, secret string) []*testNode {
+	nodes := make([]*testNode, n)
+	peers := make([]string, n)
+	for i := range nodes {
+		node := &testNode{}
+		node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node.ServeHTTP(w, r)
+		}))
+		nodes[i] = node
+		peers[i] = node.server.URL
+	}
+	for i, node := range nodes {
+		local, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.local = local.(*inmemory.InMemoryCache)
+		node.Cache, err = New(&Config{
+			Self:                   peers[i],
+			Peers:                  peers,
+			HotNumberOfItemsTarget: 100,
+			MaxValueSize:           1000,
+			Secret:                 secret,
+		}, local)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nodes
+}
+
+func closeTestCluster(nodes []*testNode) {
+	for _, node := range nodes {
+		node.server.Close()
+		node.Close()
+	}
+}
+
+func TestCluster(t *testing.T) {
+	nodes := newTestCluster(t, 3, "secret")
+	defer closeTestCluster(nodes)
+
+	for i := 0; i < 30; i++ {
+		if err := nodes[i%3].Set(fmt.Sprint("key:", i), i, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := 0
+	for _, node := range nodes {
+		if node.local.Len() == 0 {
+			t.Fatal("a node owns no keys")
+		}
+		total += node.local.Len()
+	}
+	if total != 30 {
+		t.Fatal("the keys aren't stored once, total:", total)
+	}
+
+	for _, node := range nodes {
+		for i := 0; i < 30; i++ {
+			if x, err := node.Get(fmt.Sprint("key:", i)); err != nil || x != i {
+				t.Fatal("unexpected Get result:", x, err)
+			}
+		}
+	}
+
+	key := "key:0"
+	var owner, other *testNode
+	for _, node := range nodes {
+		if node.Owner(key) == node.config.Self {
+			owner = node
+		} else {
+			other = node
+		}
+	}
+	if _, err := other.hot.Get(key); err != nil {
+		t.Fatal("the value isn't kept in the hot cache:", err)
+	}
+	// Not deleted by the hot cache yet
+	other.hot.Set(key, hotItem{X: 0, Expires: time.Now().Add(-time.Second)}, 0)
+	owner.local.Set(key, 100, 0)
+	if x, err := other.Get(key); err != nil || x != 100 {
+		t.Fatal("expected the stale hot copy not to be used, got:", x, err)
+	}
+
+	// Larger than MaxValueSize, set directly in the owner
+	owner.local.Set(key, strings.Repeat("x", 2000), 0)
+	other.hot.Del(key)
+	if _, err := other.Get(key); err != ErrValueTooLarge {
+		t.Fatal("expecting ErrValueTooLarge, got:", err)
+	}
+
+	if err := other.Del(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.local.Get(key); err != hafezieh.ErrMiss {
+		t.Fatal("Del isn't forwarded to the owner:", err)
+	}
+	if _, err := other.Get(key); err != hafezieh.ErrMiss {
+		t.Fatal("expecting a miss, got:", err)
+	}
+}
+
+func TestClusterUnreachableOwner(t *testing.T) {
+	nodes := newTestCluster(t, 2, "")
+	defer closeTestCluster(nodes)
+	nodes[1].server.Close()
+
+	for i := 0; ; i++ {
+		key := fmt.Sprint("key:", i)
+		if nodes[0].Owner(key) != nodes[1].config.Self {
+			continue
+		}
+		if _, err := nodes[0].Get(key); err == nil || err == hafezieh.ErrMiss {
+			t.Fatal("expecting an error, got:", err)
+		}
+		break
+	}
+}
+
+func TestClusterAuthorization(t *testing.T) {
+	nodes := newTestCluster(t, 1, "secret")
+	defer closeTestCluster(nodes)
+	base := nodes[0].server.URL + nodes[0].config.BasePath + "?key=a"
+
+	resp, err := http.Get(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatal("expected a request without the secret to be rejected, got:", resp.Status)
+	}
+
+	req, _ := http.NewRequest("PUT", base, strings.NewReader(strings.Repeat("x", 2000)))
+	req.Header.Set(secretHeader, "secret")
+	req.Header.Set("X-Revisit-Duration", "0")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatal("expected a large value to be rejected, got:", resp.Status)
+	}
+
+	nodes[0].config.Authorize = func(r *http.Request) error {
+		return errors.New("denied")
+	}
+	req, _ = http.NewRequest("GET", base, nil)
+	req.Header.Set(secretHeader, "secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatal("expected Authorize to be used, got:", resp.Status)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, err := New(&Config{Replicas: -1}, nil)
+	if errs, ok := err.(hafezieh.ValidationErrors); !ok || len(errs) != 2 {
+		t.Fatal("unexpected errors:", err)
+	}
+}
@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// ring is a consistent hash ring, which places replicas virtual points for
+// each node, so the keys are spread evenly, and only the keys of the changed
+// nodes move when the nodes change
+type ring struct {
+	replicas int
+	hashes   []uint32
+	nodes    map[uint32]string
+}
+
+func newRing(replicas int, nodes ...string) *ring {
+	r := &ring{
+		replicas: replicas,
+		nodes:    make(map[uint32]string, replicas*len(nodes)),
+	}
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			r.hashes = append(r.hashes, hash)
+			r.nodes[hash] = node
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// get returns the owner of the key, or "" if the ring is empty
+func (r *ring) get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
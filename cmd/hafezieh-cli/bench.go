@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// benchKeyPrefix is the prefix of the keys set by bench, which are deleted
+// at the end
+const benchKeyPrefix = "hafezieh-cli-bench:"
+
+// benchResult is the outcome of a bench worker
+type benchResult struct {
+	latencies []time.Duration
+	hits      int
+	errors    int
+}
+
+// bench runs a mix of Sets and Gets concurrently, and reports the throughput
+// and the latency percentiles
+func bench(cache hafezieh.Cache, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	n := flags.Int("n", 10000, "number of the requests")
+	concurrency := flags.Int("c", 8, "number of the concurrent workers")
+	size := flags.Int("size", 100, "size of the values in bytes")
+	keyspace := flags.Int("keys", 1000, "number of the distinct keys")
+	reads := flags.Float64("reads", 0.9, "ratio of the Gets to all the requests")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 ||
+		*n <= 0 || *concurrency <= 0 || *size < 0 || *keyspace <= 0 || *reads < 0 || *reads > 1 {
+		return errUsage
+	}
+
+	value := make([]byte, *size)
+	rand.Read(value)
+	results := make([]benchResult, *concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		requests := *n / *concurrency
+		if w < *n%*concurrency {
+			requests++
+		}
+		wg.Add(1)
+		go func(result *benchResult, requests int, r *rand.Rand) {
+			defer wg.Done()
+			result.latencies = make([]time.Duration, 0, requests)
+			for i := 0; i < requests; i++ {
+				key := benchKeyPrefix + strconv.Itoa(r.Intn(*keyspace))
+				t := time.Now()
+				var err error
+				if r.Float64() < *reads {
+					if _, err = cache.Get(key); err == nil {
+						result.hits++
+					} else if err == hafezieh.ErrMiss {
+						err = nil
+					}
+				} else {
+					err = cache.Set(key, value, 0)
+				}
+				result.latencies = append(result.latencies, time.Since(t))
+				if err != nil {
+					result.errors++
+				}
+			}
+		}(&results[w], requests, rand.New(rand.NewSource(int64(w))))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var latencies []time.Duration
+	hits, errors := 0, 0
+	for _, result := range results {
+		latencies = append(latencies, result.latencies...)
+		hits += result.hits
+		errors += result.errors
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Fprintf(out, "requests: %d in %v, %.0f ops/s\n", len(latencies), elapsed, float64(len(latencies))/elapsed.Seconds())
+	fmt.Fprintf(out, "hits: %d, errors: %d\n", hits, errors)
+	for _, p := range []float64{50, 90, 99, 100} {
+		fmt.Fprintf(out, "p%v: %v\n", p, percentile(latencies, p))
+	}
+	return cleanupBench(cache, *keyspace)
+}
+
+// percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// cleanupBench deletes the keys set by bench
+func cleanupBench(cache hafezieh.Cache, keyspace int) error {
+	if deleter, ok := cache.(hafezieh.PrefixDeleter); ok {
+		_, err := deleter.DelPrefix(benchKeyPrefix)
+		return err
+	}
+	for i := 0; i < keyspace; i++ {
+		if err := cache.Del(benchKeyPrefix + strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+// Command hafezieh-cli inspects and manipulates a cache, opened by its engine
+// URL, like a hafeziehd server or a temporary in-memory cache.
+//
+//	hafezieh-cli -url memcache://127.0.0.1:11211 set -ttl 5m user:1 hafez
+//	hafezieh-cli get user:1
+//	hafezieh-cli keys user:
+//	hafezieh-cli flush users
+//	hafezieh-cli bench -n 100000 -c 16
+//
+// Run it without arguments for the list of the commands.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cafebazaar/hafezieh"
+	_ "github.com/cafebazaar/hafezieh/dummy"
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"github.com/cafebazaar/hafezieh/memcache"
+)
+
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	usage string
+	run   func(cache hafezieh.Cache, args []string, out io.Writer) error
+}
+
+var commands = map[string]command{
+	"get":   {"get <key>...", get},
+	"set":   {"set [-ttl duration] <key> <value>", set},
+	"del":   {"del <key>...", del},
+	"keys":  {"keys [prefix]", keys},
+	"stats": {"stats", stats},
+	"flush": {"flush [namespace]", flush},
+	"bench": {"bench [-n requests] [-c concurrency] [-size bytes] [-keys n] [-reads ratio]", bench},
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: hafezieh-cli [-url engine-url] <command> [arguments]")
+	fmt.Fprintln(out, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(out, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(out, "\nEngines:", strings.Join(hafezieh.Schemes(), ", "))
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, "hafezieh-cli:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs a command line, without the program name
+func run(args []string, out, errOut io.Writer) error {
+	flags := flag.NewFlagSet("hafezieh-cli", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	url := flags.String("url", envOr("HAFEZIEH_URL", "memcache://127.0.0.1:11211"),
+		"URL of the cache engine, also read from HAFEZIEH_URL")
+	flags.Usage = func() { usage(errOut) }
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() == 0 {
+		usage(errOut)
+		return errUsage
+	}
+	cmd, found := commands[flags.Arg(0)]
+	if !found {
+		fmt.Fprintf(errOut, "unknown command %q\n", flags.Arg(0))
+		usage(errOut)
+		return errUsage
+	}
+
+	cache, err := hafezieh.Open(*url)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	err = cmd.run(cache, flags.Args()[1:], out)
+	if err == errUsage {
+		fmt.Fprintln(errOut, "Usage: hafezieh-cli", cmd.usage)
+	}
+	return err
+}
+
+func envOr(name, value string) string {
+	if v, found := os.LookupEnv(name); found {
+		return v
+	}
+	return value
+}
+
+// format returns a printable form of a value. The strings are printed as
+// they are, and the other types as JSON if possible.
+func format(x interface{}) string {
+	switch v := x.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case memcache.Item:
+		return string(v.Value)
+	}
+	if data, err := json.Marshal(x); err == nil {
+		return string(data)
+	}
+	return fmt.Sprintf("%#v", x)
+}
+
+func get(cache hafezieh.Cache, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	failed := false
+	for _, key := range args {
+		x, err := cache.Get(key)
+		if err != nil {
+			fmt.Fprintf(out, "%s: %v\n", key, err)
+			failed = true
+			continue
+		}
+		if len(args) == 1 {
+			fmt.Fprintln(out, format(x))
+		} else {
+			fmt.Fprintf(out, "%s: %s\n", key, format(x))
+		}
+	}
+	if failed {
+		return errors.New("some keys are not fetched")
+	}
+	return nil
+}
+
+func set(cache hafezieh.Cache, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("set", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	ttl := flags.Duration("ttl", hafezieh.UseDefaultValue, "revisitDuration of the item, the engine's default if not set")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		return errUsage
+	}
+	return cache.Set(flags.Arg(0), flags.Arg(1), *ttl)
+}
+
+func del(cache hafezieh.Cache, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	for _, key := range args {
+		if err := cache.Del(key); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func keys(cache hafezieh.Cache, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	lister, ok := cache.(hafezieh.KeyLister)
+	if !ok {
+		return hafezieh.ErrNotSupported
+	}
+	var prefix string
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+	keys, err := lister.Keys(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		fmt.Fprintln(out, key)
+	}
+	return nil
+}
+
+func stats(cache hafezieh.Cache, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	var x interface{}
+	switch c := cache.(type) {
+	case *inmemory.InMemoryCache:
+		x = c.Stats()
+	case *memcache.Client:
+		stats, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		x = stats
+	case hafezieh.SizedCache:
+		x = map[string]int{"Len": c.Len()}
+	default:
+		return hafezieh.ErrNotSupported
+	}
+	data, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(data))
+	return nil
+}
+
+// flush deletes all the keys, or the ones of the namespace
+func flush(cache hafezieh.Cache, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	if len(args) == 1 {
+		cache = hafezieh.Namespace(cache, args[0])
+	}
+	flusher, ok := cache.(hafezieh.Flusher)
+	if !ok {
+		return hafezieh.ErrNotSupported
+	}
+	return flusher.Flush()
+}
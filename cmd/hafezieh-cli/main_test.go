@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"github.com/cafebazaar/hafezieh/memcache"
+)
+
+func TestCommands(t *testing.T) {
+	cache, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := memcache.NewServer(cache, nil)
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+	url := "memcache://" + listener.Addr().String()
+
+	cli := func(args ...string) (string, error) {
+		var out, errOut bytes.Buffer
+		err := run(append([]string{"-url", url}, args...), &out, &errOut)
+		return out.String(), err
+	}
+	expect := func(want string, args ...string) {
+		t.Helper()
+		got, err := cli(args...)
+		if err != nil || got != want {
+			t.Fatalf("%v: unexpected output %q, %v", args, got, err)
+		}
+	}
+
+	expect("", "set", "-ttl", "1m", "users:1", "hafez")
+	expect("", "set", "users:2", "saadi")
+	expect("", "set", "posts:1", "ghazal")
+	expect("hafez\n", "get", "users:1")
+	expect("users:1: hafez\nusers:2: saadi\n", "get", "users:1", "users:2")
+	expect("users:1\nusers:2\n", "keys", "users:")
+	if out, err := cli("stats"); err != nil || !strings.Contains(out, `"curr_items": "3"`) {
+		t.Fatal("unexpected stats:", out, err)
+	}
+
+	expect("", "flush", "users")
+	expect("posts:1\n", "keys")
+	expect("", "del", "posts:1")
+	if out, err := cli("get", "posts:1"); err == nil || out != "posts:1: "+hafezieh.ErrMiss.Error()+"\n" {
+		t.Fatal("unexpected get of a missing key:", out, err)
+	}
+
+	if out, err := cli("bench", "-n", "200", "-c", "4", "-keys", "10"); err != nil ||
+		!strings.Contains(out, "requests: 200 ") || !strings.Contains(out, "errors: 0") {
+		t.Fatal("unexpected bench:", out, err)
+	}
+	expect("", "keys")
+
+	for _, args := range [][]string{{}, {"unknown"}, {"set", "key"}, {"bench", "-reads", "2"}} {
+		if _, err := cli(args...); err != errUsage {
+			t.Fatalf("%v: expected errUsage, got %v", args, err)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if p := percentile(latencies, 50); p != 5 {
+		t.Error("unexpected p50:", p)
+	}
+	if p := percentile(latencies, 99); p != 10 {
+		t.Error("unexpected p99:", p)
+	}
+	if p := percentile(nil, 50); p != 0 {
+		t.Error("unexpected percentile of nothing:", p)
+	}
+}
@@ -0,0 +1,158 @@
+// Command hafeziehd hosts an inmemory.InMemoryCache, and shares it over the
+// memcached text protocol, to be used by memcache.Client or any memcached
+// client.
+//
+//	hafeziehd -config hafeziehd.yaml
+//
+// The config file (JSON, YAML or TOML) looks like:
+//
+//	listen: ":11211"
+//	snapshot: /var/lib/hafeziehd/snapshot
+//	shutdown-timeout: 10s
+//	cache:
+//	  revisit-number-of-workers: 4
+//	  revisit-clock: 5s
+//	  cleanup:
+//	    mechanism: heap-lru
+//	    heap-target: 512MB
+//
+// and each setting can be overridden by an environment variable like
+// HAFEZIEHD_CACHE_CLEANUP_HEAP_TARGET. On SIGINT or SIGTERM, the running
+// commands are finished, and the items are written to the snapshot file,
+// which is loaded on the next start.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/config"
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"github.com/cafebazaar/hafezieh/memcache"
+)
+
+type daemonConfig struct {
+	// Listen is the TCP address of the server. Default: ":11211"
+	Listen string `mapstructure:"listen"`
+	// Snapshot is the file which the items are written to on exit, and
+	// loaded from on start. Empty disables it.
+	Snapshot string `mapstructure:"snapshot"`
+	// ShutdownTimeout is how long the running commands are waited for on
+	// exit. Default: 10 seconds
+	ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout"`
+
+	Cache inmemory.InMemoryCacheConfig `mapstructure:"cache"`
+}
+
+func (config *daemonConfig) Validate() error {
+	var errs hafezieh.ValidationErrors
+	if config.Listen == "" {
+		config.Listen = ":11211"
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 10 * time.Second
+	} else if config.ShutdownTimeout < 0 {
+		errs = errs.Append(errors.New("ShutdownTimeout can't be negative"))
+	}
+	// The expired items are cleaned up by the revisits
+	if config.Cache.RevisitNumberOfWorkers == 0 {
+		config.Cache.RevisitNumberOfWorkers = 1
+	}
+	if config.Cache.RevisitClock == 0 {
+		config.Cache.RevisitClock = 5 * time.Second
+	}
+	config.Cache.RevisitFunc = memcache.ExpireRevisitFunc
+	errs = errs.Append(config.Cache.Validate())
+	return errs.Err()
+}
+
+func loadConfig(path string) (*daemonConfig, error) {
+	c := &daemonConfig{}
+	if path != "" {
+		if err := config.LoadFile(path, c); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.FromEnv("HAFEZIEHD", c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func main() {
+	configPath := flag.String("config", "", "path of the config file")
+	listen := flag.String("listen", "", "TCP address of the server, overrides the config")
+	debug := flag.Bool("debug", false, "log the debug messages")
+	flag.Parse()
+
+	logger := hafezieh.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), *debug)
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		logger.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	if *listen != "" {
+		c.Listen = *listen
+	}
+	if c.Cache.Logger == nil {
+		c.Cache.Logger = logger
+	}
+	if err := run(c, logger); err != nil {
+		logger.Error("hafeziehd failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(c *daemonConfig, logger hafezieh.Logger) error {
+	cache, err := inmemory.NewMemoryCache(&c.Cache)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	inMemoryCache := cache.(*inmemory.InMemoryCache)
+
+	if c.Snapshot != "" {
+		n, err := loadSnapshot(c.Snapshot, inMemoryCache)
+		if err != nil {
+			return err
+		}
+		logger.Info("snapshot loaded", "path", c.Snapshot, "items", n)
+	}
+
+	server := memcache.NewServer(cache, logger)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe(c.Listen)
+	}()
+	logger.Info("listening", "addr", c.Listen)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-signals:
+		logger.Info("shutting down", "signal", sig.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("connections are closed forcibly", "error", err)
+	}
+	if c.Snapshot != "" {
+		n, err := writeSnapshot(c.Snapshot, inMemoryCache)
+		if err != nil {
+			return err
+		}
+		logger.Info("snapshot written", "path", c.Snapshot, "items", n)
+	}
+	return nil
+}
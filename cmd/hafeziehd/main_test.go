@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"github.com/cafebazaar/hafezieh/memcache"
+)
+
+func newCache(t *testing.T) *inmemory.InMemoryCache {
+	c := &daemonConfig{}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := inmemory.NewMemoryCache(&c.Cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache.(*inmemory.InMemoryCache)
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hafeziehd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot")
+
+	cache := newCache(t)
+	cache.Set("forever", memcache.Item{Flags: 1, Value: []byte("a")}, 0)
+	cache.Set("later", memcache.Item{Value: []byte("b"), Expires: time.Now().Add(time.Hour)}, time.Hour)
+	cache.Set("expired", memcache.Item{Value: []byte("c"), Expires: time.Now().Add(-time.Second)}, time.Hour)
+	cache.Set("foreign", "not an Item", 0)
+	if n, err := writeSnapshot(path, cache); err != nil || n != 2 {
+		t.Fatal("unexpected writeSnapshot:", n, err)
+	}
+	cache.Close()
+
+	restored := newCache(t)
+	defer restored.Close()
+	if n, err := loadSnapshot(path, restored); err != nil || n != 2 {
+		t.Fatal("unexpected loadSnapshot:", n, err)
+	}
+	item, err := restored.Inspect("forever")
+	if err != nil || item.Item.(memcache.Item).Flags != 1 {
+		t.Fatal("unexpected item:", item.Item, err)
+	}
+	if _, ok := item.RevisitTime(); ok {
+		t.Fatal("unexpected revisit of an item without expiration")
+	}
+	item, err = restored.Inspect("later")
+	if revisitTime, ok := item.RevisitTime(); err != nil || !ok || revisitTime.Sub(time.Now()) < 59*time.Minute {
+		t.Fatal("unexpected revisit time:", revisitTime, err)
+	}
+
+	if _, err := restored.Inspect("expired"); err == nil {
+		t.Fatal("expected the expired item not to be restored")
+	}
+
+	if n, err := loadSnapshot(filepath.Join(dir, "missing"), restored); err != nil || n != 0 {
+		t.Fatal("unexpected loadSnapshot of a missing file:", n, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatal("expected the temporary file to be removed, got", len(files), "files")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "hafeziehd*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("listen: \":11311\"\ncache:\n  cleanup:\n    mechanism: heap-lru\n    heap-target: 1MB\n")
+	f.Close()
+
+	os.Setenv("HAFEZIEHD_SHUTDOWN_TIMEOUT", "3s")
+	defer os.Unsetenv("HAFEZIEHD_SHUTDOWN_TIMEOUT")
+	c, err := loadConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Listen != ":11311" || c.ShutdownTimeout != 3*time.Second ||
+		c.Cache.Cleanup.HeapTarget != 1000000 || c.Cache.RevisitNumberOfWorkers != 1 || c.Cache.RevisitFunc == nil {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"github.com/cafebazaar/hafezieh/memcache"
+)
+
+// snapshotEntry is an item in the snapshot file
+type snapshotEntry struct {
+	Key  string
+	Item memcache.Item
+}
+
+// writeSnapshot writes the items of the cache to path, through a temporary
+// file, so the previous snapshot is kept if it fails
+func writeSnapshot(path string, cache *inmemory.InMemoryCache) (int, error) {
+	keys, err := cache.Keys("")
+	if err != nil {
+		return 0, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	encoder := gob.NewEncoder(f)
+	now := time.Now()
+	n := 0
+	for _, key := range keys {
+		inMemItem, err := cache.Inspect(key)
+		if err != nil {
+			// Deleted in the mean time
+			continue
+		}
+		item, ok := inMemItem.Item.(memcache.Item)
+		if !ok {
+			continue
+		}
+		if !item.Expires.IsZero() && !now.Before(item.Expires) {
+			continue
+		}
+		if err := encoder.Encode(&snapshotEntry{Key: key, Item: item}); err != nil {
+			f.Close()
+			return 0, err
+		}
+		n++
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(f.Name(), path)
+}
+
+// loadSnapshot sets the items of the snapshot file in the cache, except the
+// expired ones, with a revisit on their expiration. A missing file is not an
+// error.
+func loadSnapshot(path string, cache hafezieh.Cache) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	decoder := gob.NewDecoder(f)
+	now := time.Now()
+	n := 0
+	for {
+		var entry snapshotEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		var revisitDuration time.Duration
+		if expires := entry.Item.Expires; !expires.IsZero() {
+			revisitDuration = expires.Sub(now)
+			if revisitDuration <= 0 {
+				continue
+			}
+			if revisitDuration < inmemory.MinRevisitDuration {
+				revisitDuration = inmemory.MinRevisitDuration
+			}
+		}
+		if err := cache.Set(entry.Key, entry.Item, revisitDuration); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,39 @@
+package hafezieh
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Codec serializes the values, for the engines which store or send them as
+// bytes
+type Codec interface {
+	Encode(x interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+type gobValue struct {
+	X interface{}
+}
+
+type gobCodec struct{}
+
+// GobCodec encodes the values by encoding/gob. The types other than the
+// basic ones should be registered by gob.Register.
+var GobCodec Codec = gobCodec{}
+
+func (gobCodec) Encode(x interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&gobValue{X: x}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte) (interface{}, error) {
+	var v gobValue
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v.X, nil
+}
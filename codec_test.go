@@ -0,0 +1,23 @@
+package hafezieh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGobCodec(t *testing.T) {
+	for _, x := range []interface{}{1, "a", []byte("b"), 1.5, nil} {
+		data, err := GobCodec.Encode(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := GobCodec.Decode(data)
+		if err != nil || !reflect.DeepEqual(decoded, x) {
+			t.Fatalf("unexpected decoded value of %#v: %#v, %v", x, decoded, err)
+		}
+	}
+	type unregistered struct{ A int }
+	if _, err := GobCodec.Encode(unregistered{1}); err == nil {
+		t.Fatal("expecting an error for an unregistered type")
+	}
+}
@@ -0,0 +1,101 @@
+// Package config loads the configs of the cache engines, like
+// inmemory.InMemoryCacheConfig, from JSON, YAML and TOML files, environment
+// variables or generic maps, based on their mapstructure tags.
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Validator is implemented by the configs which can validate themselves, and
+// set their defaults, after being decoded
+type Validator interface {
+	Validate() error
+}
+
+// Decode fills out, a pointer to a config struct, from the input map. The
+// durations can be written like "5m", and the types implementing
+// encoding.TextUnmarshaler, like inmemory.CleanupMechanism and
+// hafezieh.ByteSize, can be written as strings. Unknown keys are reported as
+// errors. If out is a Validator, it's validated too. All the problems are
+// returned together as a hafezieh.ValidationErrors.
+func Decode(input interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.TextUnmarshallerHookFunc(),
+		),
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs hafezieh.ValidationErrors
+	if err := decoder.Decode(normalize(input)); err != nil {
+		if mErr, ok := err.(*mapstructure.Error); ok {
+			for _, e := range mErr.WrappedErrors() {
+				errs = errs.Append(e)
+			}
+		} else {
+			errs = errs.Append(err)
+		}
+	}
+	if len(errs) == 0 {
+		if v, ok := out.(Validator); ok {
+			errs = errs.Append(v.Validate())
+		}
+	}
+	return errs.Err()
+}
+
+// normalize converts the maps with non-string keys, which are produced by
+// some YAML decoders, to map[string]interface{}
+func normalize(input interface{}) interface{} {
+	switch v := input.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = normalize(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = normalize(value)
+		}
+		return s
+	}
+	return input
+}
+
+// settingName returns the mapstructure name of the field, or "" if it can't
+// be set from a config
+func settingName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name := field.Tag.Get("mapstructure")
+	for i := range name {
+		if name[i] == ',' {
+			name = name[:i]
+			break
+		}
+	}
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,125 @@
+package config_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/config"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+func checkLoadedConfig(t *testing.T, c *inmemory.InMemoryCacheConfig) {
+	if c.RevisitDefaultDuration != 10*time.Minute {
+		t.Fatal("unexpected RevisitDefaultDuration:", c.RevisitDefaultDuration)
+	}
+	if c.RevisitNumberOfWorkers != 2 {
+		t.Fatal("unexpected RevisitNumberOfWorkers:", c.RevisitNumberOfWorkers)
+	}
+	if c.RevisitClock != 30*time.Second {
+		t.Fatal("unexpected default RevisitClock:", c.RevisitClock)
+	}
+	if c.Cleanup == nil {
+		t.Fatal("Cleanup is not loaded")
+	}
+	if c.Cleanup.Mechanism != inmemory.CleanupHeapBasedLRU {
+		t.Fatal("unexpected Mechanism:", c.Cleanup.Mechanism)
+	}
+	if c.Cleanup.HeapTarget != 512000000 {
+		t.Fatal("unexpected HeapTarget:", c.Cleanup.HeapTarget)
+	}
+	if c.Cleanup.Percent != 10 {
+		t.Fatal("unexpected Percent:", c.Cleanup.Percent)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string]string{
+		"json": `{
+			"revisit-default-duration": "10m",
+			"revisit-number-of-workers": 2,
+			"cleanup": {"mechanism": "heap-lru", "heap-target": "512MB", "percent": 10}
+		}`,
+		"yaml": `
+revisit-default-duration: 10m
+revisit-number-of-workers: 2
+cleanup:
+  mechanism: heap-lru
+  heap-target: 512MB
+  percent: 10
+`,
+		"toml": `
+revisit-default-duration = "10m"
+revisit-number-of-workers = 2
+
+[cleanup]
+mechanism = "heap-lru"
+heap-target = "512MB"
+percent = 10
+`,
+	}
+	for format, content := range files {
+		var c inmemory.InMemoryCacheConfig
+		if err := config.Load(strings.NewReader(content), format, &c); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		checkLoadedConfig(t, &c)
+	}
+
+	var c inmemory.InMemoryCacheConfig
+	if err := config.Load(strings.NewReader(""), "ini", &c); err == nil {
+		t.Fatal("expecting an error for an unknown format")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	env := map[string]string{
+		"HZ_REVISIT_DEFAULT_DURATION":  "10m",
+		"HZ_REVISIT_NUMBER_OF_WORKERS": "2",
+		"HZ_CLEANUP_MECHANISM":         "heap-lru",
+		"HZ_CLEANUP_HEAP_TARGET":       "512MB",
+		"HZ_CLEANUP_PERCENT":           "10",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	var c inmemory.InMemoryCacheConfig
+	if err := config.FromEnv("HZ", &c); err != nil {
+		t.Fatal(err)
+	}
+	checkLoadedConfig(t, &c)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var c inmemory.InMemoryCacheConfig
+	err := config.Decode(map[string]interface{}{
+		"revisit-default-duration": "ten minutes",
+		"unknown-key":              1,
+		"cleanup": map[string]interface{}{
+			"mechanism": "heap-mru",
+		},
+	}, &c)
+	errs, ok := err.(hafezieh.ValidationErrors)
+	if !ok {
+		t.Fatalf("expecting ValidationErrors, got: %#v", err)
+	}
+	if len(errs) != 3 {
+		t.Fatal("unexpected errors:", errs)
+	}
+
+	c = inmemory.InMemoryCacheConfig{}
+	err = config.Decode(map[string]interface{}{
+		"revisit-number-of-workers": -1,
+		"cleanup": map[string]interface{}{
+			"mechanism": "number-lru",
+		},
+	}, &c)
+	errs, ok = err.(hafezieh.ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatal("unexpected validation errors:", err)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding"
+	"os"
+	"reflect"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// FromEnv fills out like Decode, from the environment variables named after
+// the mapstructure tags of the fields, in upper case, with "_" instead of "-"
+// and prefix. e.g. Cleanup.HeapTarget of inmemory.InMemoryCacheConfig is read
+// from HAFEZIEH_CLEANUP_HEAP_TARGET, if prefix is "HAFEZIEH".
+func FromEnv(prefix string, out interface{}) error {
+	return Decode(envSettings(prefix, reflect.TypeOf(out)), out)
+}
+
+func envSettings(prefix string, t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	settings := map[string]interface{}{}
+	if t.Kind() != reflect.Struct {
+		return settings
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := settingName(field)
+		if name == "" {
+			continue
+		}
+		envName := strings.ToUpper(strings.Replace(name, "-", "_", -1))
+		if prefix != "" {
+			envName = prefix + "_" + envName
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct && !reflect.PtrTo(fieldType).Implements(textUnmarshalerType) {
+			if nested := envSettings(envName, fieldType); len(nested) > 0 {
+				settings[name] = nested
+			}
+			continue
+		}
+		if value, found := os.LookupEnv(envName); found {
+			settings[name] = value
+		}
+	}
+	return settings
+}
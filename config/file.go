@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Load decodes the config in the format ("json", "yaml" or "toml") from r,
+// and fills out like Decode
+func Load(r io.Reader, format string, out interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var input interface{}
+	switch strings.ToLower(format) {
+	case "json":
+		err = json.Unmarshal(data, &input)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &input)
+	case "toml":
+		m := map[string]interface{}{}
+		err = toml.Unmarshal(data, &m)
+		input = m
+	default:
+		return fmt.Errorf("unknown config format: %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return Decode(input, out)
+}
+
+// LoadFile is like Load, and detects the format by the extension of the file
+func LoadFile(path string, out interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Load(f, strings.TrimPrefix(filepath.Ext(path), "."), out)
+}
@@ -20,6 +20,10 @@ func (c *dummyCache) Del(key string) error {
 	return nil
 }
 
+func (c *dummyCache) Flush() error {
+	return nil
+}
+
 func (c *dummyCache) Close() error {
 	return nil
 }
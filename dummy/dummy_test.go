@@ -28,4 +28,18 @@ func TestDummyEngine(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	err = d.(hafezieh.Flusher).Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenDummy(t *testing.T) {
+	d, err := hafezieh.Open("dummy://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get("t1"); err != hafezieh.ErrMiss {
+		t.Fatal("unexpected error:", err)
+	}
 }
@@ -0,0 +1,13 @@
+package dummy
+
+import (
+	"net/url"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func init() {
+	hafezieh.Register("dummy", func(u *url.URL) (hafezieh.Cache, error) {
+		return NewDummyCache(), nil
+	})
+}
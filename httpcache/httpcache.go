@@ -0,0 +1,430 @@
+// Package httpcache caches the GET responses of a net/http handler in a
+// hafezieh.Cache, like a shared HTTP cache in front of it.
+//
+// A response is stored if its status is cacheable, it has a max-age or
+// s-maxage (or the default max age is set), and it isn't no-store, private,
+// no-cache, Vary: * or Set-Cookie. It's stored with max-age as the
+// revisitDuration, so the engine should expire the items on revisit, but the
+// stale ones are never served anyway. The responses which Vary are stored
+// per the values of the request headers they vary on. The ETags are matched
+// against If-None-Match, and 304 is returned for the matching ones.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+// keyPrefix is the prefix of the keys of the responses in the cache
+const keyPrefix = "httpcache:"
+
+// cacheableStatus are the statuses which are cacheable by default
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// hopByHopHeaders are not stored
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func init() {
+	gob.Register(entry{})
+	gob.Register(variants{})
+}
+
+// entry is a stored response
+type entry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+	Expires  time.Time
+}
+
+// variants is stored in the primary key of a URL, and tells which request
+// headers its response varies on
+type variants struct {
+	Vary []string
+}
+
+// Option configures the Handler returned by New
+type Option func(*Handler)
+
+// WithDefaultMaxAge sets the max age of the cacheable responses without
+// max-age or s-maxage. By default they are not stored.
+func WithDefaultMaxAge(d time.Duration) Option {
+	return func(h *Handler) {
+		h.defaultMaxAge = d
+	}
+}
+
+// WithMaxBodySize sets the size of the largest body which is stored.
+// Default: 1MB
+func WithMaxBodySize(size hafezieh.ByteSize) Option {
+	return func(h *Handler) {
+		h.maxBodySize = int(size)
+	}
+}
+
+// WithKeyFunc sets the function which identifies the resources of the
+// requests. Default: the host and the URI of the request
+func WithKeyFunc(fn func(r *http.Request) string) Option {
+	return func(h *Handler) {
+		h.keyFunc = fn
+	}
+}
+
+// WithLogger sets the logger of the failed cache calls, which are discarded
+// by default
+func WithLogger(logger hafezieh.Logger) Option {
+	return func(h *Handler) {
+		h.logger = hafezieh.LoggerWith(logger)
+	}
+}
+
+// Handler serves the requests from the cache, or by next
+type Handler struct {
+	cache         hafezieh.Cache
+	next          http.Handler
+	defaultMaxAge time.Duration
+	maxBodySize   int
+	keyFunc       func(r *http.Request) string
+	logger        hafezieh.Logger
+}
+
+// New returns a Handler which caches the responses of next in cache
+func New(cache hafezieh.Cache, next http.Handler, options ...Option) *Handler {
+	h := &Handler{
+		cache:       cache,
+		next:        next,
+		maxBodySize: 1000 * 1000,
+		keyFunc:     defaultKey,
+		logger:      hafezieh.NopLogger,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// Middleware returns New as a middleware
+func Middleware(cache hafezieh.Cache, options ...Option) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return New(cache, next, options...)
+	}
+}
+
+func defaultKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// primaryKey returns the key of the variants of the request
+func (h *Handler) primaryKey(r *http.Request) string {
+	sum := sha1.Sum([]byte(h.keyFunc(r)))
+	return keyPrefix + hex.EncodeToString(sum[:])
+}
+
+// variantKey returns the key of the response of the request, which varies
+// on the vary headers
+func variantKey(primary string, vary []string, r *http.Request) string {
+	hash := fnv.New64a()
+	for _, name := range vary {
+		hash.Write([]byte(name))
+		hash.Write([]byte{0})
+		for _, value := range r.Header[name] {
+			hash.Write([]byte(value))
+			hash.Write([]byte{0})
+		}
+		hash.Write([]byte{0})
+	}
+	return primary + ":" + strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// parseVary returns the canonical names of the headers in the Vary headers,
+// sorted
+func parseVary(header http.Header) []string {
+	var vary []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary = append(vary, textproto.CanonicalMIMEHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+	return vary
+}
+
+// parseCacheControl returns the directives of the Cache-Control headers, in
+// lower case
+func parseCacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			directives[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+	return directives
+}
+
+// maxAge returns the freshness lifetime of a response, or false if it
+// shouldn't be stored
+func (h *Handler) maxAge(status int, header http.Header) (time.Duration, bool) {
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	cc := parseCacheControl(header)
+	for _, directive := range []string{"no-store", "private", "no-cache"} {
+		if _, found := cc[directive]; found {
+			return 0, false
+		}
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if arg, found := cc[directive]; found {
+			seconds, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return h.defaultMaxAge, h.defaultMaxAge > 0
+}
+
+// bypass tells if the request should be passed to next as it is
+func bypass(r *http.Request) bool {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return true
+	}
+	_, noStore := parseCacheControl(r.Header)["no-store"]
+	return noStore
+}
+
+// revalidate tells if the request doesn't accept the stored responses
+func revalidate(r *http.Request) bool {
+	cc := parseCacheControl(r.Header)
+	if _, found := cc["no-cache"]; found {
+		return true
+	}
+	if r.Header.Get("Pragma") == "no-cache" {
+		return true
+	}
+	arg, found := cc["max-age"]
+	return found && arg == "0"
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if bypass(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	primary := h.primaryKey(r)
+	if !revalidate(r) {
+		if e, ok := h.lookup(primary, r); ok {
+			w.Header().Set("X-Cache", "HIT")
+			serveEntry(w, r, e)
+			return
+		}
+	}
+
+	// The conditionals are answered by the stored response, so a full one is
+	// needed
+	upstream := r.WithContext(r.Context())
+	upstream.Header = cloneHeader(r.Header)
+	upstream.Header.Del("If-None-Match")
+	upstream.Header.Del("If-Modified-Since")
+	rec := &recorder{w: w, header: http.Header{}, limit: h.maxBodySize}
+	h.next.ServeHTTP(rec, upstream)
+	if rec.spilled {
+		return
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	now := time.Now()
+	e := &entry{
+		Status:   rec.status,
+		Header:   rec.header,
+		Body:     rec.body.Bytes(),
+		StoredAt: now,
+	}
+	if maxAge, ok := h.maxAge(rec.status, rec.header); ok {
+		vary := parseVary(rec.header)
+		if len(vary) == 0 || vary[0] != "*" {
+			e.Expires = now.Add(maxAge)
+			h.store(primary, vary, r, e, maxAge)
+		}
+	}
+	w.Header().Set("X-Cache", "MISS")
+	serveEntry(w, r, e)
+}
+
+// lookup returns the fresh stored response of the request
+func (h *Handler) lookup(primary string, r *http.Request) (*entry, bool) {
+	x, err := h.cache.Get(primary)
+	if err != nil {
+		if err != hafezieh.ErrMiss {
+			h.logger.Warn("http cache lookup failed", "error", err)
+		}
+		return nil, false
+	}
+	v, ok := x.(variants)
+	if !ok {
+		return nil, false
+	}
+	key := variantKey(primary, v.Vary, r)
+	x, err = h.cache.Get(key)
+	if err != nil {
+		if err != hafezieh.ErrMiss {
+			h.logger.Warn("http cache lookup failed", "error", err)
+		}
+		return nil, false
+	}
+	e, ok := x.(entry)
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(e.Expires) {
+		// Not expired by the engine yet
+		h.cache.Del(key)
+		return nil, false
+	}
+	return &e, true
+}
+
+func (h *Handler) store(primary string, vary []string, r *http.Request, e *entry, maxAge time.Duration) {
+	for _, name := range hopByHopHeaders {
+		e.Header.Del(name)
+	}
+	revisitDuration := maxAge
+	if revisitDuration < inmemory.MinRevisitDuration {
+		revisitDuration = inmemory.MinRevisitDuration
+	}
+	if err := h.cache.Set(primary, variants{Vary: vary}, revisitDuration); err != nil {
+		h.logger.Warn("http cache store failed", "error", err)
+		return
+	}
+	if err := h.cache.Set(variantKey(primary, vary, r), *e, revisitDuration); err != nil {
+		h.logger.Warn("http cache store failed", "error", err)
+	}
+}
+
+// serveEntry writes the response, or 304 if the request's If-None-Match
+// matches its ETag
+func serveEntry(w http.ResponseWriter, r *http.Request, e *entry) {
+	header := w.Header()
+	for name, values := range e.Header {
+		header[name] = values
+	}
+	if !e.Expires.IsZero() {
+		age := time.Since(e.StoredAt) / time.Second
+		header.Set("Age", strconv.FormatInt(int64(age), 10))
+	}
+	if e.Status == http.StatusOK && etagMatches(e.Header.Get("Etag"), r.Header.Get("If-None-Match")) {
+		for _, name := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			header.Del(name)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.Status)
+	w.Write(e.Body)
+}
+
+// etagMatches compares etag to the If-None-Match header, weakly
+func etagMatches(etag, ifNoneMatch string) bool {
+	if etag == "" || ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// recorder buffers the response of next, until its body exceeds limit,
+// after which it's spilled to w, and not stored
+type recorder struct {
+	w       http.ResponseWriter
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	limit   int
+	spilled bool
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.spilled {
+		return rec.w.Write(p)
+	}
+	if rec.body.Len()+len(p) <= rec.limit {
+		return rec.body.Write(p)
+	}
+	rec.spilled = true
+	header := rec.w.Header()
+	for name, values := range rec.header {
+		header[name] = values
+	}
+	rec.w.WriteHeader(rec.status)
+	if _, err := rec.w.Write(rec.body.Bytes()); err != nil {
+		return 0, err
+	}
+	rec.body.Reset()
+	return rec.w.Write(p)
+}
@@ -0,0 +1,153 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh/httpcache"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+// origin counts the requests, and responds by the query
+type origin struct {
+	calls int
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.calls++
+	query := r.URL.Query()
+	if cc := query.Get("cc"); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	if vary := query.Get("vary"); vary != "" {
+		w.Header().Set("Vary", vary)
+	}
+	if query.Get("cookie") != "" {
+		w.Header().Set("Set-Cookie", "a=b")
+	}
+	w.Header().Set("Etag", `"v1"`)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%d %s %s", o.calls, r.Header.Get("Accept-Language"), query.Get("body"))
+}
+
+func newHandler(t *testing.T, options ...httpcache.Option) (http.Handler, *origin) {
+	cache, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &origin{}
+	return httpcache.Middleware(cache, options...)(o), o
+}
+
+func get(h http.Handler, url string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestCaching(t *testing.T) {
+	h, o := newHandler(t)
+
+	w := get(h, "/a?cc=max-age=60")
+	if w.Code != http.StatusOK || w.Body.String() != "1  " || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatal("unexpected first response:", w.Code, w.Body.String(), w.Header())
+	}
+	w = get(h, "/a?cc=max-age=60")
+	if w.Body.String() != "1  " || w.Header().Get("X-Cache") != "HIT" || w.Header().Get("Age") != "0" ||
+		w.Header().Get("Content-Type") != "text/plain" {
+		t.Fatal("unexpected cached response:", w.Body.String(), w.Header())
+	}
+	if w = get(h, "/a?cc=max-age=60", "Cache-Control", "no-cache"); w.Body.String() != "2  " {
+		t.Fatal("expected a revalidation, got", w.Body.String())
+	}
+
+	for _, url := range []string{
+		"/b", "/b?cc=no-store,max-age=60", "/b?cc=private,max-age=60",
+		"/b?cc=max-age=60&vary=*", "/b?cc=max-age=60&cookie=1",
+	} {
+		calls := o.calls
+		get(h, url)
+		get(h, url)
+		if o.calls != calls+2 {
+			t.Error("unexpected cached response of", url)
+		}
+	}
+
+	calls := o.calls
+	req := httptest.NewRequest("POST", "/a?cc=max-age=60", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	get(h, "/a?cc=max-age=60", "Authorization", "Bearer x")
+	if o.calls != calls+2 {
+		t.Error("expected POST and authorized requests to bypass the cache")
+	}
+}
+
+func TestVary(t *testing.T) {
+	h, o := newHandler(t)
+	url := "/a?cc=max-age=60&vary=accept-language"
+	if w := get(h, url, "Accept-Language", "fa"); w.Body.String() != "1 fa " {
+		t.Fatal("unexpected response:", w.Body.String())
+	}
+	if w := get(h, url, "Accept-Language", "en"); w.Body.String() != "2 en " {
+		t.Fatal("expected a separate variant, got", w.Body.String())
+	}
+	if w := get(h, url, "Accept-Language", "fa"); w.Body.String() != "1 fa " {
+		t.Fatal("unexpected cached variant:", w.Body.String())
+	}
+	if o.calls != 2 {
+		t.Fatal("unexpected calls:", o.calls)
+	}
+}
+
+func TestETag(t *testing.T) {
+	h, o := newHandler(t)
+	url := "/a?cc=max-age=60"
+	if w := get(h, url, "If-None-Match", `"v1"`); w.Code != http.StatusNotModified || w.Body.Len() != 0 ||
+		w.Header().Get("Etag") != `"v1"` || w.Header().Get("Content-Type") != "" {
+		t.Fatal("unexpected response of a miss:", w.Code, w.Body.String(), w.Header())
+	}
+	if w := get(h, url, "If-None-Match", `"v0", W/"v1"`); w.Code != http.StatusNotModified {
+		t.Fatal("unexpected response of a hit:", w.Code)
+	}
+	if w := get(h, url, "If-None-Match", `"v2"`); w.Code != http.StatusOK || w.Body.String() != "1  " {
+		t.Fatal("unexpected response of a mismatch:", w.Code, w.Body.String())
+	}
+	if o.calls != 1 {
+		t.Fatal("unexpected calls:", o.calls)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	h, o := newHandler(t, httpcache.WithDefaultMaxAge(time.Second))
+	get(h, "/a")
+	get(h, "/a")
+	if o.calls != 1 {
+		t.Fatal("expected the default max age to be used")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if w := get(h, "/a"); w.Body.String() != "2  " {
+		t.Fatal("expected a stale response not to be served, got", w.Body.String())
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h, o := newHandler(t, httpcache.WithMaxBodySize(10))
+	url := "/a?cc=max-age=60&body=" + strings.Repeat("x", 20)
+	for i := 1; i <= 2; i++ {
+		w := get(h, url)
+		if w.Body.String() != fmt.Sprintf("%d  %s", i, strings.Repeat("x", 20)) || w.Header().Get("Content-Type") != "text/plain" {
+			t.Fatal("unexpected response of a large body:", w.Body.String(), w.Header())
+		}
+	}
+	if o.calls != 2 {
+		t.Fatal("expected a large body not to be stored")
+	}
+}
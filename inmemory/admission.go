@@ -0,0 +1,137 @@
+package inmemory
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// AdmissionFilter decides whether a new key should be stored, so the keys
+// which are set once and never read again don't push the useful items out.
+// It must be safe for concurrent use.
+type AdmissionFilter interface {
+	// Admit records a request to store the key, which is not available in the
+	// cache, and returns true if it should be stored
+	Admit(key string) bool
+}
+
+// bloomFilter is a set of keys with no false negatives. It's not safe for
+// concurrent use.
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes int
+}
+
+func newBloomFilter(expectedKeys int) *bloomFilter {
+	if expectedKeys < 1 {
+		expectedKeys = 1
+	}
+	// ~1% false positives with 10 bits per key and 7 hashes
+	m := uint64(expectedKeys) * 10
+	return &bloomFilter{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		hashes: 7,
+	}
+}
+
+// add adds the key, and returns true if it was (probably) added before
+func (f *bloomFilter) add(key string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := h1>>32 | h1<<32 | 1
+	found := true
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+			f.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return found
+}
+
+func (f *bloomFilter) reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+}
+
+type doorkeeper struct {
+	mutex        sync.Mutex
+	filter       *bloomFilter
+	expectedKeys int
+	additions    int
+	window       time.Duration
+	resetAt      time.Time
+}
+
+// NewDoorkeeper returns an AdmissionFilter which admits a key on its second
+// request within the window. The requests are remembered by a bloom filter,
+// which is reset after the window or after expectedKeys requests, whichever
+// comes first. window=0 means no time based reset. expectedKeys is at least 2,
+// so a key can be requested twice between the resets.
+func NewDoorkeeper(expectedKeys int, window time.Duration) AdmissionFilter {
+	if expectedKeys < 2 {
+		expectedKeys = 2
+	}
+	d := &doorkeeper{
+		filter:       newBloomFilter(expectedKeys),
+		expectedKeys: expectedKeys,
+		window:       window,
+	}
+	if window > 0 {
+		d.resetAt = time.Now().Add(window)
+	}
+	return d
+}
+
+func (d *doorkeeper) Admit(key string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.window > 0 {
+		if n := time.Now(); n.After(d.resetAt) {
+			d.filter.reset()
+			d.additions = 0
+			d.resetAt = n.Add(d.window)
+		}
+	}
+	if d.additions >= d.expectedKeys {
+		d.filter.reset()
+		d.additions = 0
+	}
+	if d.filter.add(key) {
+		return true
+	}
+	d.additions++
+	return false
+}
+
+type sketchAdmission struct {
+	mutex     sync.Mutex
+	sketch    *countMinSketch
+	threshold uint8
+}
+
+// NewSketchAdmission returns an AdmissionFilter which admits a key when it's
+// requested at least threshold times (at most 15). The requests are counted
+// by a count-min sketch for expectedKeys keys, which halves the counts
+// periodically, so the old requests fade away.
+func NewSketchAdmission(expectedKeys int, threshold uint8) AdmissionFilter {
+	if threshold > sketchMaxCounter {
+		threshold = sketchMaxCounter
+	}
+	return &sketchAdmission{
+		sketch:    newCountMinSketch(expectedKeys),
+		threshold: threshold,
+	}
+}
+
+func (s *sketchAdmission) Admit(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sketch.increment(key)
+	return s.sketch.estimate(key) >= s.threshold
+}
@@ -0,0 +1,91 @@
+package inmemory
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestDoorkeeper(t *testing.T) {
+	d := NewDoorkeeper(100, 0)
+	if d.Admit("t1") {
+		t.Fatal("expected the first request to be rejected")
+	}
+	if !d.Admit("t1") {
+		t.Fatal("expected the second request to be admitted")
+	}
+	// Filling the filter resets it
+	for i := 0; i < 150; i++ {
+		d.Admit(fmt.Sprintf("key:%d", i))
+	}
+	if d.Admit("t1") {
+		t.Fatal("expected the filter to be reset")
+	}
+
+	d = NewDoorkeeper(100, time.Millisecond)
+	d.Admit("t1")
+	time.Sleep(2 * time.Millisecond)
+	if d.Admit("t1") {
+		t.Fatal("expected the filter to be reset after the window")
+	}
+}
+
+func TestDoorkeeperTinyExpectedKeys(t *testing.T) {
+	for _, expectedKeys := range []int{0, 1} {
+		d := NewDoorkeeper(expectedKeys, 0)
+		if d.Admit("t1") {
+			t.Fatalf("%d: expected the first request to be rejected", expectedKeys)
+		}
+		if !d.Admit("t1") {
+			t.Fatalf("%d: expected the second request to be admitted", expectedKeys)
+		}
+	}
+}
+
+func TestSketchAdmission(t *testing.T) {
+	s := NewSketchAdmission(100, 3)
+	for i := 0; i < 2; i++ {
+		if s.Admit("t1") {
+			t.Fatal("expected the request to be rejected")
+		}
+	}
+	if !s.Admit("t1") {
+		t.Fatal("expected the third request to be admitted")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{Admission: NewDoorkeeper(100, time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(*InMemoryCache)
+	c.Set("t1", 1, 0)
+	if _, err := c.Get("t1"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	c.Set("t1", 1, 0)
+	if _, err := c.Get("t1"); err != nil {
+		t.Fatal(err)
+	}
+	// Resetting an available key is not filtered
+	c.Set("t1", 2, 0)
+	if val, err := c.Get("t1"); err != nil || val != 2 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+	if err := c.Add("t2", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Counters are not filtered
+	if _, err := c.Incr("t3", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.Stats()
+	expected := InMemoryCacheStats{Items: 2, Hits: 2, Misses: 1, RejectedAdmissions: 2}
+	if stats != expected {
+		t.Fatalf("unexpected stats: %+v != %+v", stats, expected)
+	}
+}
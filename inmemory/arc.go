@@ -0,0 +1,144 @@
+package inmemory
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	arcT1 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+type arcEntry struct {
+	key   string
+	where int
+}
+
+// arcPolicy is the Adaptive Replacement Cache policy. The keys seen once are
+// kept in t1 and the frequent keys in t2, and the ghost lists b1 and b2
+// remember the recently evicted keys of them, to adapt p, the target size of
+// t1, to the workload. A scan only passes through t1, so it can't flush t2.
+type arcPolicy struct {
+	mutex    sync.Mutex
+	capacity int
+	p        int
+	lists    [4]*list.List
+	entries  map[string]*list.Element
+}
+
+// NewARCPolicy returns an Adaptive Replacement Cache policy for a cache of
+// capacity items
+func NewARCPolicy(capacity int) EvictionPolicy {
+	a := &arcPolicy{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+	}
+	for i := range a.lists {
+		a.lists[i] = list.New()
+	}
+	return a
+}
+
+func (a *arcPolicy) Reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.p = 0
+	a.entries = make(map[string]*list.Element)
+	for i := range a.lists {
+		a.lists[i].Init()
+	}
+}
+
+func (a *arcPolicy) moveTo(element *list.Element, where int) {
+	entry := element.Value.(*arcEntry)
+	a.lists[entry.where].Remove(element)
+	entry.where = where
+	a.entries[entry.key] = a.lists[where].PushFront(entry)
+}
+
+func (a *arcPolicy) OnSet(key string, item *InMemItem) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	element, found := a.entries[key]
+	if !found {
+		a.entries[key] = a.lists[arcT1].PushFront(&arcEntry{key, arcT1})
+		a.trimGhosts()
+		return
+	}
+	b1, b2 := a.lists[arcB1].Len(), a.lists[arcB2].Len()
+	switch element.Value.(*arcEntry).where {
+	case arcB1:
+		delta := 1
+		if b2 > b1 {
+			delta = b2 / b1
+		}
+		a.p += delta
+		if a.p > a.capacity {
+			a.p = a.capacity
+		}
+	case arcB2:
+		delta := 1
+		if b1 > b2 {
+			delta = b1 / b2
+		}
+		a.p -= delta
+		if a.p < 0 {
+			a.p = 0
+		}
+	}
+	a.moveTo(element, arcT2)
+}
+
+func (a *arcPolicy) OnGet(key string, item *InMemItem) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	element, found := a.entries[key]
+	if found && element.Value.(*arcEntry).where <= arcT2 {
+		a.moveTo(element, arcT2)
+	}
+}
+
+func (a *arcPolicy) OnDel(key string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	element, found := a.entries[key]
+	if found && element.Value.(*arcEntry).where <= arcT2 {
+		a.lists[element.Value.(*arcEntry).where].Remove(element)
+		delete(a.entries, key)
+	}
+}
+
+func (a *arcPolicy) Victims(n int) []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	keys := make([]string, 0, n)
+	t1, t2 := a.lists[arcT1], a.lists[arcT2]
+	for len(keys) < n && t1.Len()+t2.Len() > 0 {
+		var element *list.Element
+		if t1.Len() > 0 && (t1.Len() > a.p || t2.Len() == 0) {
+			element = t1.Back()
+			a.moveTo(element, arcB1)
+		} else {
+			element = t2.Back()
+			a.moveTo(element, arcB2)
+		}
+		keys = append(keys, element.Value.(*arcEntry).key)
+	}
+	a.trimGhosts()
+	return keys
+}
+
+// trimGhosts keeps t1+b1 within capacity, and all the lists within twice of
+// the capacity
+func (a *arcPolicy) trimGhosts() {
+	t1, t2, b1, b2 := a.lists[arcT1], a.lists[arcT2], a.lists[arcB1], a.lists[arcB2]
+	for b1.Len() > 0 && t1.Len()+b1.Len() > a.capacity {
+		delete(a.entries, b1.Remove(b1.Back()).(*arcEntry).key)
+	}
+	for b2.Len() > 0 && t1.Len()+t2.Len()+b1.Len()+b2.Len() > 2*a.capacity {
+		delete(a.entries, b2.Remove(b2.Back()).(*arcEntry).key)
+	}
+}
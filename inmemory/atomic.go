@@ -0,0 +1,131 @@
+package inmemory
+
+import (
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Add stores x only if the key is not available, otherwise
+// hafezieh.ErrExists is returned
+func (c *InMemoryCache) Add(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.setIf(key, x, revisitDuration, true, func(inMemItem *InMemItem) error {
+		if inMemItem != nil {
+			return hafezieh.ErrExists
+		}
+		return nil
+	})
+}
+
+// Replace stores x only if the key is available, otherwise hafezieh.ErrMiss
+// is returned
+func (c *InMemoryCache) Replace(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.setIf(key, x, revisitDuration, false, func(inMemItem *InMemItem) error {
+		if inMemItem == nil {
+			return hafezieh.ErrMiss
+		}
+		return nil
+	})
+}
+
+// Gets is like Get, but also returns the cas token of the item
+func (c *InMemoryCache) Gets(key string) (interface{}, uint64, error) {
+	inMemItem, cas, err := c.get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return inMemItem.Item, cas, nil
+}
+
+// CompareAndSwap stores x only if the cas token of the item is still cas,
+// otherwise hafezieh.ErrCASConflict is returned
+func (c *InMemoryCache) CompareAndSwap(key string, x interface{}, cas uint64, revisitDuration time.Duration) error {
+	return c.setIf(key, x, revisitDuration, false, func(inMemItem *InMemItem) error {
+		if inMemItem == nil || inMemItem.cas != cas {
+			return hafezieh.ErrCASConflict
+		}
+		return nil
+	})
+}
+
+// Update calls fn with the current value of the key, and stores the result.
+// fn is called while the cache is locked, so it must not call the cache.
+func (c *InMemoryCache) Update(key string, fn func(old interface{}) (interface{}, error)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return hafezieh.ErrClosed
+	}
+	inMemItem, found := c.positiveItem(key)
+	var old interface{}
+	if found {
+		old = inMemItem.Item
+	}
+	x, err := fn(old)
+	if err != nil {
+		return err
+	}
+	n := time.Now()
+	if found {
+		c.replaceItem(key, c.updatedItem(inMemItem, x, n))
+		return nil
+	}
+	revisitTime, err := c.revisitTimeAfter(n, hafezieh.UseDefaultValue)
+	if err != nil {
+		return err
+	}
+	c.storeItem(key, &InMemItem{
+		Item:        x,
+		CreatedAt:   n,
+		LastAccess:  n,
+		revisitTime: revisitTime,
+	})
+	return nil
+}
+
+// updatedItem returns a copy of inMemItem with the new value and cas token,
+// which keeps the scheduled revisit. c.mutex should be locked by the caller.
+func (c *InMemoryCache) updatedItem(inMemItem *InMemItem, x interface{}, n time.Time) *InMemItem {
+	c.lastCAS++
+	return &InMemItem{
+		Item:        x,
+		CreatedAt:   inMemItem.CreatedAt,
+		LastAccess:  n,
+		Hits:        inMemItem.HitCount(),
+		revisitTime: inMemItem.revisitTime,
+		revisitFunc: inMemItem.revisitFunc,
+		cas:         c.lastCAS,
+		tags:        inMemItem.tags,
+	}
+}
+
+// setIf stores x if check, which is called with the current item (or nil)
+// while the cache is locked, returns no error. If admission is set, a new key
+// is checked by the AdmissionFilter too.
+func (c *InMemoryCache) setIf(key string, x interface{}, revisitDuration time.Duration, admission bool, check func(*InMemItem) error) error {
+	n := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return hafezieh.ErrClosed
+	}
+	revisitTime, err := c.revisitTimeAfter(n, revisitDuration)
+	if err != nil {
+		return err
+	}
+	inMemItem, _ := c.positiveItem(key)
+	if err := check(inMemItem); err != nil {
+		return err
+	}
+	if admission && !c.admit(key) {
+		return nil
+	}
+	c.storeItem(key, &InMemItem{
+		Item:        x,
+		CreatedAt:   n,
+		LastAccess:  n,
+		revisitTime: revisitTime,
+	})
+	return nil
+}
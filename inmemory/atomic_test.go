@@ -0,0 +1,102 @@
+package inmemory
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func newAtomicCache(t *testing.T) hafezieh.AtomicCache {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := d.(hafezieh.AtomicCache)
+	if !ok {
+		t.Fatal("InMemoryCache doesn't implement AtomicCache")
+	}
+	return c
+}
+
+func TestAddReplace(t *testing.T) {
+	c := newAtomicCache(t)
+	if err := c.Replace("t1", 1, 0); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	if err := c.Add("t1", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add("t1", 2, 0); err != hafezieh.ErrExists {
+		t.Fatal("expecting ErrExists, got:", err)
+	}
+	if err := c.Replace("t1", 3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := c.Get("t1"); err != nil || val != 3 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	c := newAtomicCache(t)
+	if err := c.CompareAndSwap("t1", 1, 0, 0); err != hafezieh.ErrCASConflict {
+		t.Fatal("expecting ErrCASConflict, got:", err)
+	}
+	if err := c.Set("t1", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	val, cas, err := c.Gets("t1")
+	if err != nil || val != 1 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+	if err := c.CompareAndSwap("t1", 2, cas, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CompareAndSwap("t1", 3, cas, 0); err != hafezieh.ErrCASConflict {
+		t.Fatal("expecting ErrCASConflict, got:", err)
+	}
+	if val, err := c.Get("t1"); err != nil || val != 2 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := newAtomicCache(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				err := c.Update("counter", func(old interface{}) (interface{}, error) {
+					if old == nil {
+						return 1, nil
+					}
+					return old.(int) + 1, nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if val, err := c.Get("counter"); err != nil || val != 1000 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+
+	errAbort := errors.New("abort")
+	err := c.Update("counter", func(old interface{}) (interface{}, error) {
+		return 0, errAbort
+	})
+	if err != errAbort {
+		t.Fatal("expecting errAbort, got:", err)
+	}
+	if val, _ := c.Get("counter"); val != 1000 {
+		t.Fatalf("Unexpected results. val=%v", val)
+	}
+}
@@ -6,56 +6,72 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/cafebazaar/hafezieh"
 )
 
 type janitor struct {
 	config *InMemoryCleanupConfig
 
 	cleanupFunc CleanupFunc
-	stopFlag    bool
+	policy      EvictionPolicy
+	stopCh      chan struct{}
 	wg          sync.WaitGroup
 }
 
 type InMemoryCleanupConfig struct {
-	Mechanism           CleanupMechanism `mapstructure:"mechanism"`
-	Clock               time.Duration    `mapstructure:"clock"`
-	HeapTarget          uint64           `mapstructure:"heap-target"`
-	NumberOfItemsTarget uint64           `mapstructure:"number-target"`
-	Percent             float64          `mapstructure:"percent"`
+	Mechanism           CleanupMechanism  `mapstructure:"mechanism"`
+	Clock               time.Duration     `mapstructure:"clock"`
+	HeapTarget          hafezieh.ByteSize `mapstructure:"heap-target"`
+	NumberOfItemsTarget uint64            `mapstructure:"number-target"`
+	Percent             float64           `mapstructure:"percent"`
 	CustomFunc          CleanupFunc
+	// Policy chooses the items to be removed by CleanupHeapBasedPolicy and
+	// CleanupNumberBasedPolicy
+	Policy EvictionPolicy
+	// NamespaceQuotas limits the number of items of the namespaces (see
+	// hafezieh.Namespace) by their names, like NumberOfItemsTarget. The least
+	// recently used items of a namespace are removed on each clock.
+	NamespaceQuotas map[string]uint64 `mapstructure:"namespace-quotas"`
 }
 
 func (config *InMemoryCleanupConfig) validateAndSetDefaults() error {
+	var errs hafezieh.ValidationErrors
 	if config.Mechanism == CleanupCustomFunc && config.CustomFunc == nil {
-		return errors.New("No CustomFunc is set but Mechanism is set on CleanupCustomFunc")
+		errs = errs.Append(errors.New("No CustomFunc is set but Mechanism is set on CleanupCustomFunc"))
 	}
-	if config.Mechanism != CleanupNone {
-		if config.Clock == 0 {
-			config.Clock = time.Minute
-		}
+	if config.Clock == 0 {
+		config.Clock = time.Minute
+	}
+	if config.Mechanism != CleanupNone || len(config.NamespaceQuotas) > 0 {
 		if config.Clock < 5*time.Second {
-			return errors.New("Clock should be at keast 5 seconds")
+			errs = errs.Append(errors.New("Clock should be at keast 5 seconds"))
 		}
 	}
-	if config.Mechanism == CleanupHeapBasedLRU {
+	if (config.Mechanism == CleanupHeapBasedPolicy || config.Mechanism == CleanupNumberBasedPolicy) && config.Policy == nil {
+		errs = errs.Append(errors.New("No Policy is set but Mechanism is set on a policy based cleanup"))
+	}
+	if config.Mechanism == CleanupHeapBasedLRU || config.Mechanism == CleanupHeapBasedPolicy {
 		if config.HeapTarget == 0 {
-			return errors.New("No HeapTarget is set")
+			errs = errs.Append(errors.New("No HeapTarget is set"))
 		}
 		if config.Percent == 0 {
 			config.Percent = 5
 		}
 		if config.Percent > 100 || config.Percent < 0 {
-			return errors.New("Percent should be between 0 and 100")
+			errs = errs.Append(errors.New("Percent should be between 0 and 100"))
 		}
-	} else if config.Mechanism == CleanupNumberBasedLRU {
+	} else if config.Mechanism.numberBased() {
 		if config.NumberOfItemsTarget == 0 {
-			return errors.New("No NumberOfItemsTarget is set")
+			errs = errs.Append(errors.New("No NumberOfItemsTarget is set"))
 		}
 	}
-	return nil
+	if _, found := cleanupMechanismNames[config.Mechanism]; !found {
+		errs = errs.Append(fmt.Errorf("unknown cleanup mechanism: %v", config.Mechanism))
+	}
+	return errs.Err()
 }
 
 type CleanupMechanism uint8
@@ -74,8 +90,80 @@ const (
 	// items will be deleted so the number of items became (nearly) equal to
 	// CleanupNumberOfItemsTarget
 	CleanupNumberBasedLRU = iota
+	// CleanupNumberBasedLFU is like CleanupNumberBasedLRU, but the least
+	// frequently used items (based on Hits) will be deleted
+	CleanupNumberBasedLFU = iota
+	// CleanupNumberBasedARC is like CleanupNumberBasedLRU, but the items will
+	// be chosen by the Adaptive Replacement Cache policy, which balances the
+	// recency and frequency of the accesses
+	CleanupNumberBasedARC = iota
+	// CleanupNumberBasedWTinyLFU is like CleanupNumberBasedLRU, but the items
+	// will be chosen by the W-TinyLFU policy, which only keeps the new items if
+	// they are estimated more frequent than the items they push out
+	CleanupNumberBasedWTinyLFU = iota
+	// CleanupHeapBasedPolicy is like CleanupHeapBasedLRU, but the items will
+	// be chosen by the Policy
+	CleanupHeapBasedPolicy = iota
+	// CleanupNumberBasedPolicy is like CleanupNumberBasedLRU, but the items
+	// will be chosen by the Policy
+	CleanupNumberBasedPolicy = iota
 )
 
+var cleanupMechanismNames = map[CleanupMechanism]string{
+	CleanupNone:                "none",
+	CleanupCustomFunc:          "custom-func",
+	CleanupHeapBasedLRU:        "heap-lru",
+	CleanupNumberBasedLRU:      "number-lru",
+	CleanupNumberBasedLFU:      "number-lfu",
+	CleanupNumberBasedARC:      "number-arc",
+	CleanupNumberBasedWTinyLFU: "number-wtinylfu",
+	CleanupHeapBasedPolicy:     "heap-policy",
+	CleanupNumberBasedPolicy:   "number-policy",
+}
+
+// ParseCleanupMechanism returns the mechanism by its name, like "heap-lru" or
+// "number-lru"
+func ParseCleanupMechanism(name string) (CleanupMechanism, error) {
+	for m, n := range cleanupMechanismNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return CleanupNone, fmt.Errorf("unknown cleanup mechanism: %q", name)
+}
+
+func (m CleanupMechanism) String() string {
+	if name, found := cleanupMechanismNames[m]; found {
+		return name
+	}
+	return fmt.Sprintf("CleanupMechanism(%d)", uint8(m))
+}
+
+func (m CleanupMechanism) MarshalText() ([]byte, error) {
+	if name, found := cleanupMechanismNames[m]; found {
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("unknown cleanup mechanism: %d", uint8(m))
+}
+
+func (m *CleanupMechanism) UnmarshalText(text []byte) error {
+	mechanism, err := ParseCleanupMechanism(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mechanism
+	return nil
+}
+
+func (m CleanupMechanism) numberBased() bool {
+	switch m {
+	case CleanupNumberBasedLRU, CleanupNumberBasedLFU, CleanupNumberBasedARC, CleanupNumberBasedWTinyLFU,
+		CleanupNumberBasedPolicy:
+		return true
+	}
+	return false
+}
+
 type CleanupFunc func(*InMemoryCache)
 
 type lastAccessKeyPair struct {
@@ -99,111 +187,161 @@ func (j *janitor) leastRecentlyUsedPairs(pairs lruPairs, k int) lruPairs {
 
 func (j *janitor) generatePairs(cache *InMemoryCache) lruPairs {
 	cache.mutex.RLock()
-	n := len(cache.items)
-	pairs := make(lruPairs, n)
-	k := 0
+	pairs := make(lruPairs, 0, len(cache.items)-len(cache.negatives))
 	for key, i := range cache.items {
-		pairs[k].lastAccess = i.LastAccess.Unix()
-		pairs[k].key = key
-		k++
+		if !i.negative {
+			pairs = append(pairs, lastAccessKeyPair{atomic.LoadInt64(&i.lastAccess), key})
+		}
 	}
 	cache.mutex.RUnlock()
 	return pairs
 }
 
-func (j *janitor) deletePairs(cache *InMemoryCache, pairs lruPairs) {
-	cache.mutex.Lock()
-	for _, item := range pairs {
-		delete(cache.items, item.key)
-	}
-	cache.mutex.Unlock()
-}
-
-func (j *janitor) heapBasedLRUCleanup(cache *InMemoryCache) {
+// heapBasedCleanup removes Percent% of the items chosen by the policy, if
+// HeapAlloc is higher than HeapTarget
+func (j *janitor) heapBasedCleanup(cache *InMemoryCache) {
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
-	if mem.HeapAlloc > j.config.HeapTarget {
+	if mem.HeapAlloc > uint64(j.config.HeapTarget) {
 		runtime.GC()
 	}
 	runtime.ReadMemStats(&mem)
-	if mem.HeapAlloc > j.config.HeapTarget {
-		logrus.Debugf("[InMemoryCache:heapBasedLRUCleanup] HeapAlloc=%d - Cleanup is triggered", mem.HeapAlloc)
-		pairs := j.generatePairs(cache)
-		n := len(pairs)
+	if mem.HeapAlloc > uint64(j.config.HeapTarget) {
+		n := cache.Len()
 		k := (int(float64(n) * j.config.Percent * 0.01))
 		if k >= n {
 			k = n - 1
 		}
 		if k > 0 {
-			pairs = j.leastRecentlyUsedPairs(pairs, k)
-			seconds := time.Now().Unix() - pairs[k-1].lastAccess
-			logrus.Debugf("[InMemoryCache:heapBasedLRUCleanup] Rmoving %d items (most recent was accessed %d seconds ago)", k, seconds)
-			j.deletePairs(cache, pairs)
-			logrus.Debugf("[InMemoryCache:heapBasedLRUCleanup] Calling GC")
+			keys := j.policy.Victims(k)
+			j.deleteKeys(cache, keys)
 			runtime.GC()
+			heapAlloc := mem.HeapAlloc
 			runtime.ReadMemStats(&mem)
-			logrus.Debugf("[InMemoryCache:heapBasedLRUCleanup] New HeapAlloc=%d", mem.HeapAlloc)
+			cache.logger.Debug("heap based cleanup",
+				"items", n, "evicted", len(keys), "heap_target", uint64(j.config.HeapTarget),
+				"heap_alloc_before", heapAlloc, "heap_alloc", mem.HeapAlloc)
 		} else {
-			logrus.Debugf("[InMemoryCache:heapBasedLRUCleanup] CleanupPercent(%g%%) of %d means no items will be removed", j.config.Percent, n)
+			cache.logger.Debug("heap based cleanup removes no items",
+				"items", n, "percent", j.config.Percent, "heap_target", uint64(j.config.HeapTarget),
+				"heap_alloc", mem.HeapAlloc)
 		}
 	}
 }
 
-func (j *janitor) numberBasedLRUCleanup(cache *InMemoryCache) {
-	cache.mutex.RLock()
-	n := len(cache.items)
-	cache.mutex.RUnlock()
-	if n > int(j.config.NumberOfItemsTarget) {
-		logrus.Debugf("[InMemoryCache:numberBasedLRUCleanup] len(cache.items)=%d - Cleanup is triggered", n)
-		pairs := j.generatePairs(cache)
-		n := len(pairs)
-		k := n - int(j.config.NumberOfItemsTarget)
-		pairs = j.leastRecentlyUsedPairs(pairs, k)
-		if k > 0 {
-			seconds := time.Now().Unix() - pairs[k-1].lastAccess
-			logrus.Debugf("[InMemoryCache:numberBasedLRUCleanup] Rmoving %d items (most recent was accessed %d seconds ago)", k, seconds)
-			j.deletePairs(cache, pairs)
-			logrus.Debugf("[InMemoryCache:numberBasedLRUCleanup] Calling GC")
-			runtime.GC()
-			var mem runtime.MemStats
-			runtime.ReadMemStats(&mem)
-			logrus.Debugf("[InMemoryCache:numberBasedLRUCleanup] New HeapAlloc=%d", mem.HeapAlloc)
-		}
+// numberBasedCleanup removes the items chosen by the policy, so the number of
+// items became (nearly) equal to NumberOfItemsTarget
+func (j *janitor) numberBasedCleanup(cache *InMemoryCache) {
+	n := cache.Len()
+	k := n - int(j.config.NumberOfItemsTarget)
+	if k > 0 {
+		keys := j.policy.Victims(k)
+		j.deleteKeys(cache, keys)
+		runtime.GC()
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		cache.logger.Debug("number based cleanup",
+			"items", n, "evicted", len(keys), "number_target", j.config.NumberOfItemsTarget,
+			"heap_alloc", mem.HeapAlloc)
+	}
+}
+
+func (j *janitor) deleteKeys(cache *InMemoryCache, keys []string) {
+	cache.mutex.Lock()
+	for _, key := range keys {
+		cache.deleteItem(key)
 	}
+	cache.mutex.Unlock()
 }
 
 func (j *janitor) noopCleanup(cache *InMemoryCache) {}
 
 func (j *janitor) loop(cache *InMemoryCache) {
 	defer j.wg.Done()
+	ticker := time.NewTicker(j.config.Clock)
+	defer ticker.Stop()
 	for {
-		time.Sleep(j.config.Clock)
-		if j.stopFlag {
+		select {
+		case <-j.stopCh:
 			return
+		case <-ticker.C:
+			j.cleanup(cache)
 		}
-		j.cleanupFunc(cache)
-		if j.stopFlag {
-			return
+	}
+}
+
+// cleanup expires the negative items, applies the namespace quotas, and then
+// calls cleanupFunc
+func (j *janitor) cleanup(cache *InMemoryCache) {
+	cache.mutex.Lock()
+	cache.expireNegatives(time.Now())
+	cache.mutex.Unlock()
+	j.quotaCleanup(cache)
+	j.cleanupFunc(cache)
+}
+
+// quotaCleanup removes the least recently used items of the namespaces which
+// have more items than their quotas
+func (j *janitor) quotaCleanup(cache *InMemoryCache) {
+	var keys []string
+	cache.mutex.RLock()
+	for name, quota := range cache.quotas {
+		var pairs lruPairs
+		cache.keys.walkPrefix(hafezieh.NamespacePrefix(name), func(key string) bool {
+			if inMemItem := cache.items[key]; !inMemItem.negative {
+				pairs = append(pairs, lastAccessKeyPair{atomic.LoadInt64(&inMemItem.lastAccess), key})
+			}
+			return true
+		})
+		if k := len(pairs) - int(quota); k > 0 {
+			for _, pair := range j.leastRecentlyUsedPairs(pairs, k) {
+				keys = append(keys, pair.key)
+			}
 		}
 	}
+	cache.mutex.RUnlock()
+	if len(keys) > 0 {
+		j.deleteKeys(cache, keys)
+		cache.logger.Debug("namespace quota cleanup", "evicted", len(keys))
+	}
 }
 
+// stop stops the loop immediately, or after the current cleanup. Not designed
+// to be called more than once.
 func (j *janitor) stop() {
-	j.stopFlag = true
+	close(j.stopCh)
 	j.wg.Wait()
 }
 
 func newJanitor(config *InMemoryCleanupConfig, cache *InMemoryCache) (*janitor, error) {
 	j := &janitor{
 		config: config,
+		stopCh: make(chan struct{}),
 	}
 	switch j.config.Mechanism {
 	case CleanupNone:
 		j.cleanupFunc = j.noopCleanup
 	case CleanupHeapBasedLRU:
-		j.cleanupFunc = j.heapBasedLRUCleanup
+		j.policy = &lruPolicy{janitor: j, cache: cache}
+		j.cleanupFunc = j.heapBasedCleanup
 	case CleanupNumberBasedLRU:
-		j.cleanupFunc = j.numberBasedLRUCleanup
+		j.policy = &lruPolicy{janitor: j, cache: cache}
+		j.cleanupFunc = j.numberBasedCleanup
+	case CleanupNumberBasedLFU:
+		j.policy = &lfuPolicy{cache: cache}
+		j.cleanupFunc = j.numberBasedCleanup
+	case CleanupNumberBasedARC:
+		j.policy = NewARCPolicy(int(config.NumberOfItemsTarget))
+		j.cleanupFunc = j.numberBasedCleanup
+	case CleanupNumberBasedWTinyLFU:
+		j.policy = NewWTinyLFUPolicy(int(config.NumberOfItemsTarget))
+		j.cleanupFunc = j.numberBasedCleanup
+	case CleanupHeapBasedPolicy:
+		j.policy = config.Policy
+		j.cleanupFunc = j.heapBasedCleanup
+	case CleanupNumberBasedPolicy:
+		j.policy = config.Policy
+		j.cleanupFunc = j.numberBasedCleanup
 	case CleanupCustomFunc:
 		j.cleanupFunc = j.config.CustomFunc
 	default:
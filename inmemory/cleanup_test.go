@@ -4,12 +4,14 @@ import "testing"
 import "fmt"
 import "time"
 
+import "github.com/cafebazaar/hafezieh"
+
 func TestGeneratePairs(t *testing.T) {
 	c := &InMemoryCache{items: make(map[string]*InMemItem)}
 	j := &janitor{}
 	n := time.Now()
 	for i := 0; i < 10; i++ {
-		c.items[fmt.Sprintf("%03d", i)] = &InMemItem{i, n, n.Add(time.Duration(i) * time.Second), 0, 0, nil}
+		c.items[fmt.Sprintf("%03d", i)] = &InMemItem{Item: i, CreatedAt: n, lastAccess: n.Add(time.Duration(i) * time.Second).UnixNano()}
 	}
 	pairs := j.generatePairs(c)
 	if len(pairs) != 10 {
@@ -21,7 +23,7 @@ func TestGeneratePairs(t *testing.T) {
 		for _, p := range pairs {
 			if p.key == key {
 				found = true
-				expectedLastAccess := n.Add(time.Duration(i) * time.Second).Unix()
+				expectedLastAccess := n.Add(time.Duration(i) * time.Second).UnixNano()
 				if p.lastAccess != expectedLastAccess {
 					t.Fatalf("unexpected lastAccess for items[%s]: %v != %v", key, p.lastAccess, expectedLastAccess)
 				}
@@ -67,17 +69,21 @@ func TestLeastRecentlyUsedPairs(t *testing.T) {
 	}
 }
 
-func TestDeletePairs(t *testing.T) {
+func TestDeleteKeys(t *testing.T) {
 	j := &janitor{config: &InMemoryCleanupConfig{NumberOfItemsTarget: 100}}
 	c := &InMemoryCache{
 		items: make(map[string]*InMemItem),
 	}
 	n := time.Now()
 	for i := 0; i < 10; i++ {
-		c.items[fmt.Sprintf("%03d", i)] = &InMemItem{i, n, n.Add(time.Duration(i) * time.Second), 0, 0, nil}
+		c.items[fmt.Sprintf("%03d", i)] = &InMemItem{Item: i, CreatedAt: n, lastAccess: n.Add(time.Duration(i) * time.Second).UnixNano()}
 	}
 	pairs := j.generatePairs(c)
-	j.deletePairs(c, pairs[:9])
+	keys := make([]string, 9)
+	for i := range keys {
+		keys[i] = pairs[i].key
+	}
+	j.deleteKeys(c, keys)
 	if len(c.items) != 1 {
 		t.Fatal("unexpected len:", len(c.items))
 	}
@@ -126,15 +132,16 @@ func TestValidateAndSetDefaults(t *testing.T) {
 func BenchmarkNumberBasedLRUCleanup(b *testing.B) {
 	b.ReportAllocs()
 	j := &janitor{config: &InMemoryCleanupConfig{NumberOfItemsTarget: 100}}
-	c := &InMemoryCache{items: make(map[string]*InMemItem)}
+	c := &InMemoryCache{items: make(map[string]*InMemItem), logger: hafezieh.NopLogger}
+	j.policy = &lruPolicy{janitor: j, cache: c}
 	nw := time.Now()
 	for i := 0; i < 100; i++ {
-		c.items[fmt.Sprintf("%03d", i)] = &InMemItem{i, nw, nw.Add(time.Duration(i) * time.Second), 0, 0, nil}
+		c.items[fmt.Sprintf("%03d", i)] = &InMemItem{Item: i, CreatedAt: nw, lastAccess: nw.Add(time.Duration(i) * time.Second).UnixNano()}
 	}
 	for n := 0; n < b.N; n++ {
 		for i := 100; i < 200; i++ {
-			c.items[fmt.Sprintf("%03d", i)] = &InMemItem{i, nw, nw.Add(time.Duration(i) * time.Second), 0, 0, nil}
-			j.numberBasedLRUCleanup(c)
+			c.items[fmt.Sprintf("%03d", i)] = &InMemItem{Item: i, CreatedAt: nw, lastAccess: nw.Add(time.Duration(i) * time.Second).UnixNano()}
+			j.numberBasedCleanup(c)
 		}
 		n := len(c.items)
 		if n != 100 {
@@ -142,3 +149,65 @@ func BenchmarkNumberBasedLRUCleanup(b *testing.B) {
 		}
 	}
 }
+
+func TestCleanupMechanismText(t *testing.T) {
+	for m, name := range cleanupMechanismNames {
+		text, err := m.MarshalText()
+		if err != nil || string(text) != name {
+			t.Fatalf("unexpected text of %d: %q, %v", uint8(m), text, err)
+		}
+		var parsed CleanupMechanism
+		if err := parsed.UnmarshalText(text); err != nil || parsed != m {
+			t.Fatalf("unexpected parse of %q: %v, %v", text, parsed, err)
+		}
+	}
+	if _, err := ParseCleanupMechanism("heap-mru"); err == nil {
+		t.Fatal("expecting an error for an unknown mechanism")
+	}
+	if _, err := CleanupMechanism(100).MarshalText(); err == nil {
+		t.Fatal("expecting an error for an unknown mechanism")
+	}
+}
+
+type recordingLogger struct {
+	hafezieh.Logger
+	msgs    []string
+	keyvals [][]interface{}
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.msgs = append(l.msgs, msg)
+	l.keyvals = append(l.keyvals, keyvals)
+}
+
+func TestCleanupLogs(t *testing.T) {
+	logger := &recordingLogger{}
+	cache, err := NewMemoryCache(&InMemoryCacheConfig{
+		Name:   "users",
+		Logger: logger,
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedLRU,
+			NumberOfItemsTarget: 5,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	c := cache.(*InMemoryCache)
+	for i := 0; i < 8; i++ {
+		c.Set(fmt.Sprint(i), i, 0)
+	}
+	c.janitor.cleanupFunc(c)
+
+	if len(logger.msgs) != 1 || logger.msgs[0] != "number based cleanup" {
+		t.Fatal("unexpected logs:", logger.msgs)
+	}
+	fields := map[interface{}]interface{}{}
+	for i := 0; i+1 < len(logger.keyvals[0]); i += 2 {
+		fields[logger.keyvals[0][i]] = logger.keyvals[0][i+1]
+	}
+	if fields["cache"] != "users" || fields["evicted"] != 3 || fields["items"] != 8 {
+		t.Fatal("unexpected fields:", logger.keyvals[0])
+	}
+}
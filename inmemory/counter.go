@@ -0,0 +1,71 @@
+package inmemory
+
+import (
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Incr adds delta to the integer value of the key, and stores the result as
+// an int64
+func (c *InMemoryCache) Incr(key string, delta int64) (int64, error) {
+	n := time.Now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return 0, hafezieh.ErrClosed
+	}
+	inMemItem, found := c.positiveItem(key)
+	if !found {
+		revisitTime, err := c.revisitTimeAfter(n, hafezieh.UseDefaultValue)
+		if err != nil {
+			return 0, err
+		}
+		c.storeItem(key, &InMemItem{
+			Item:        delta,
+			CreatedAt:   n,
+			LastAccess:  n,
+			revisitTime: revisitTime,
+		})
+		return delta, nil
+	}
+	value, ok := toInt64(inMemItem.Item)
+	if !ok {
+		return 0, hafezieh.ErrNotNumeric
+	}
+	value += delta
+	c.replaceItem(key, c.updatedItem(inMemItem, value, n))
+	return value, nil
+}
+
+// Decr subtracts delta from the integer value of the key, and stores the
+// result as an int64
+func (c *InMemoryCache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
+func toInt64(x interface{}) (int64, bool) {
+	switch v := x.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	}
+	return 0, false
+}
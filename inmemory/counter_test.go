@@ -0,0 +1,55 @@
+package inmemory
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestIncrDecr(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{RevisitDefaultDuration: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := d.(hafezieh.CounterCache)
+	if !ok {
+		t.Fatal("InMemoryCache doesn't implement CounterCache")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := c.Incr("counter", 2); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	val, err := c.Decr("counter", 500)
+	if err != nil || val != 1500 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+	if d.(*InMemoryCache).items["counter"].revisitTime == nil {
+		t.Fatal("Expected the default revisit duration to be used")
+	}
+
+	if err := c.Set("int", 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := c.Incr("int", 1); err != nil || val != 6 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+	if err := c.Set("str", "5", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr("str", 1); err != hafezieh.ErrNotNumeric {
+		t.Fatal("expecting ErrNotNumeric, got:", err)
+	}
+}
@@ -1,56 +1,116 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cafebazaar/hafezieh"
 )
 
+// MinRevisitDuration is the smallest revisitDuration supported by the engine
+const MinRevisitDuration = 5 * time.Second
+
 var (
 	ErrSmallDuration = errors.New("less than 5 seconds isn't supported by this engine")
 )
 
 type InMemoryCache struct {
-	config *InMemoryCacheConfig
+	counters cacheCounters
+	config   *InMemoryCacheConfig
 
 	items           map[string]*InMemItem
+	keys            radixTree
+	tags            map[string]map[string]struct{}
+	negatives       map[string]struct{}
 	revisitTimeQMan *revisitTimeQueueManager
 	mutex           sync.RWMutex
+	lastCAS         uint64
 	janitor         *janitor
+	policy          EvictionPolicy
+	quotas          map[string]uint64
+	logger          hafezieh.Logger
+	closed          bool
+	done            chan struct{}
+	// reconfigureMutex is held while the background goroutines are replaced
+	// or stopped
+	reconfigureMutex sync.Mutex
 }
 
 type InMemoryCacheConfig struct {
+	// Name is added to the logs of the cache, as the "cache" field
+	Name string `mapstructure:"name"`
+	// Logger receives the logs of the cache, which are discarded by default
+	Logger hafezieh.Logger
+
 	RevisitDefaultDuration time.Duration `mapstructure:"revisit-default-duration"`
 	RevisitNumberOfWorkers int           `mapstructure:"revisit-number-of-workers"`
 	RevisitClock           time.Duration `mapstructure:"revisit-clock"`
-	RevisitFunc            RevisitFunc
+	// RevisitDrainOnClose makes Close wait for the revisits which are already
+	// assigned to the workers, instead of dropping them
+	RevisitDrainOnClose bool `mapstructure:"revisit-drain-on-close"`
+	// RevisitFunc is called for the items which are set without their own
+	// RevisitFunc
+	RevisitFunc RevisitFunc
 
 	Cleanup *InMemoryCleanupConfig `mapstructure:"cleanup"`
+
+	// Admission, if set, decides whether a new key should be stored. The
+	// rejected keys are silently dropped by Set and Add.
+	Admission AdmissionFilter
+
+	// NegativeDefaultDuration is used by SetNegative for UseDefaultValue
+	NegativeDefaultDuration time.Duration `mapstructure:"negative-default-duration"`
+	// NegativeNumberOfItemsTarget, if >0, limits the number of the negative
+	// items, separately from the other items
+	NegativeNumberOfItemsTarget int `mapstructure:"negative-number-target"`
+}
+
+// Validate sets the defaults of the unset fields, and returns all the
+// problems of the config as a hafezieh.ValidationErrors
+func (config *InMemoryCacheConfig) Validate() error {
+	return config.validateAndSetDefaults()
+}
+
+// logger returns the Logger of the cache, with its name
+func (config *InMemoryCacheConfig) logger() hafezieh.Logger {
+	if config.Name == "" {
+		return hafezieh.LoggerWith(config.Logger)
+	}
+	return hafezieh.LoggerWith(config.Logger, "cache", config.Name)
 }
 
 func (config *InMemoryCacheConfig) validateAndSetDefaults() error {
+	var errs hafezieh.ValidationErrors
 	if config.RevisitNumberOfWorkers > 0 {
 		if config.RevisitClock == 0 {
 			config.RevisitClock = 30 * time.Second
 		}
-		if config.RevisitFunc == nil {
-			return errors.New("No RevisitFunc is set but RevisitNumberOfWorkers is greater than 0")
-		}
+	} else if config.RevisitNumberOfWorkers < 0 {
+		errs = errs.Append(errors.New("RevisitNumberOfWorkers can't be negative"))
+	}
+	if config.RevisitDefaultDuration < 0 {
+		errs = errs.Append(hafezieh.ErrNegativeDuration)
 	}
 
 	if config.Cleanup != nil {
-		err := config.Cleanup.validateAndSetDefaults()
-		if err != nil {
-			return err
-		}
+		errs = errs.Append(config.Cleanup.validateAndSetDefaults())
 	}
 
-	return nil
+	return errs.Err()
 }
 
 type InMemItem struct {
+	// lastAccess (in UnixNano) and hits are updated atomically by Get, so
+	// LastAccess and Hits are only up to date in the copies returned by
+	// Inspect and Range, and passed to the RevisitFuncs. LastAccessed and
+	// HitCount read them. They are the first fields, for the alignment of the
+	// atomic operations.
+	lastAccess int64
+	hits       uint64
+
 	Item       interface{}
 	CreatedAt  time.Time
 	LastAccess time.Time
@@ -58,85 +118,332 @@ type InMemItem struct {
 
 	index       int
 	revisitTime *time.Time
+	revisitFunc RevisitFunc
+	cas         uint64
+	tags        []string
+
+	// negative items remember a miss or an error, until expiresAt (if set)
+	negative  bool
+	err       error
+	expiresAt time.Time
+}
+
+// SetOptions holds the optional parameters of SetWithOptions
+type SetOptions struct {
+	// RevisitDuration has the same meaning as revisitDuration in Set
+	RevisitDuration time.Duration
+	// RevisitFunc, if set, is called on revisit of this item instead of
+	// InMemoryCacheConfig.RevisitFunc
+	RevisitFunc RevisitFunc
+	// Tags can be used to delete the item by InvalidateTag
+	Tags []string
 }
 
 func (c *InMemoryCache) Set(key string, x interface{}, revisitDuration time.Duration) error {
-	if revisitDuration < 0 {
-		return hafezieh.ErrNegativeDuration
-	}
-	if revisitDuration == hafezieh.UseDefaultValue {
-		revisitDuration = c.config.RevisitDefaultDuration
-	}
-	if revisitDuration > 0 && revisitDuration < (5*time.Second) {
-		return ErrSmallDuration
+	return c.SetWithOptions(key, x, &SetOptions{RevisitDuration: revisitDuration})
+}
+
+// SetWithOptions is like Set, but also accepts the per-item options
+func (c *InMemoryCache) SetWithOptions(key string, x interface{}, options *SetOptions) error {
+	if options == nil {
+		options = &SetOptions{}
 	}
+	n := time.Now()
 
 	c.mutex.Lock()
-	n := time.Now()
-	var revisitTime *time.Time
-	if revisitDuration > 0 {
-		r := n.Add(revisitDuration)
-		revisitTime = &r
+	defer c.mutex.Unlock()
+	if c.closed {
+		return hafezieh.ErrClosed
 	}
-	c.items[key] = &InMemItem{
+	revisitTime, err := c.revisitTimeAfter(n, options.RevisitDuration)
+	if err != nil {
+		return err
+	}
+	if !c.admit(key) {
+		return nil
+	}
+	c.storeItem(key, &InMemItem{
 		Item:        x,
 		CreatedAt:   n,
 		LastAccess:  n,
 		Hits:        0,
 		revisitTime: revisitTime,
+		revisitFunc: options.RevisitFunc,
+		tags:        options.Tags,
+	})
+	return nil
+}
+
+// revisitTimeAfter validates revisitDuration, and returns the revisit time
+// based on it, or nil if no revisit is needed. c.mutex should be locked by the
+// caller.
+func (c *InMemoryCache) revisitTimeAfter(n time.Time, revisitDuration time.Duration) (*time.Time, error) {
+	if revisitDuration == hafezieh.UseDefaultValue {
+		revisitDuration = c.config.RevisitDefaultDuration
+	}
+	if revisitDuration < 0 {
+		return nil, hafezieh.ErrNegativeDuration
+	}
+	if revisitDuration == 0 {
+		return nil, nil
+	}
+	if revisitDuration < MinRevisitDuration {
+		return nil, ErrSmallDuration
 	}
-	if c.revisitTimeQMan != nil && revisitTime != nil {
+	r := n.Add(revisitDuration)
+	return &r, nil
+}
+
+// storeItem assigns inMemItem to the key with a new cas token, and schedules
+// its revisit. c.mutex should be locked by the caller.
+func (c *InMemoryCache) storeItem(key string, inMemItem *InMemItem) {
+	c.lastCAS++
+	inMemItem.cas = c.lastCAS
+	if old, found := c.items[key]; found {
+		c.untag(key, old)
+		if old.negative {
+			delete(c.negatives, key)
+		}
+	} else {
+		c.keys.insert(key)
+	}
+	inMemItem.lastAccess = inMemItem.LastAccess.UnixNano()
+	inMemItem.hits = uint64(inMemItem.Hits)
+	c.items[key] = inMemItem
+	c.tag(key, inMemItem)
+	if inMemItem.negative {
+		c.negatives[key] = struct{}{}
+	}
+	c.scheduleRevisit(key, inMemItem)
+	if c.policy != nil {
+		if inMemItem.negative {
+			// In case it replaces a positive item
+			c.policy.OnDel(key)
+		} else {
+			c.policy.OnSet(key, inMemItem)
+		}
+	}
+}
+
+// replaceItem assigns the updated inMemItem to the available key, which keeps
+// the tags and the scheduled revisit. c.mutex should be locked by the caller.
+func (c *InMemoryCache) replaceItem(key string, inMemItem *InMemItem) {
+	c.items[key] = inMemItem
+	if c.policy != nil {
+		c.policy.OnSet(key, inMemItem)
+	}
+}
+
+// scheduleRevisit pushes the revisit of the item to the queue, if needed.
+// c.mutex should be locked by the caller.
+func (c *InMemoryCache) scheduleRevisit(key string, inMemItem *InMemItem) {
+	if c.revisitTimeQMan != nil && inMemItem.revisitTime != nil {
 		c.revisitTimeQMan.Push(&InMemKey{
 			key:         key,
-			revisitTime: *revisitTime,
+			revisitTime: *inMemItem.revisitTime,
 		})
 	}
-	c.mutex.Unlock()
-	return nil
+}
+
+// deleteItem removes the key. c.mutex should be locked by the caller.
+func (c *InMemoryCache) deleteItem(key string) {
+	if inMemItem, found := c.items[key]; found {
+		c.untag(key, inMemItem)
+		c.keys.delete(key)
+		delete(c.items, key)
+		delete(c.negatives, key)
+		if c.policy != nil {
+			c.policy.OnDel(key)
+		}
+	}
 }
 
 func (c *InMemoryCache) Get(key string) (interface{}, error) {
+	inMemItem, _, err := c.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return inMemItem.Item, nil
+}
+
+// get returns the item and its cas token, or the error of a negative item
+func (c *InMemoryCache) get(key string) (*InMemItem, uint64, error) {
 	c.mutex.RLock()
+	if c.closed {
+		c.mutex.RUnlock()
+		return nil, 0, hafezieh.ErrClosed
+	}
 	inMemItem, found := c.items[key]
-	c.mutex.RUnlock()
+	var cas uint64
 	if found {
-		inMemItem.LastAccess = time.Now() // Not guaranteed to always increase
-		inMemItem.Hits++                  // Not guaranteed to be accurate
-		return inMemItem.Item, nil
+		cas = inMemItem.cas
+		if !inMemItem.negative {
+			atomic.StoreInt64(&inMemItem.lastAccess, time.Now().UnixNano()) // Not guaranteed to always increase
+			atomic.AddUint64(&inMemItem.hits, 1)
+		}
+	}
+	policy := c.policy
+	c.mutex.RUnlock()
+	if !found {
+		atomic.AddUint64(&c.counters.misses, 1)
+		return nil, 0, hafezieh.ErrMiss
+	}
+	if inMemItem.negative {
+		return nil, 0, c.negativeError(key, inMemItem)
+	}
+	atomic.AddUint64(&c.counters.hits, 1)
+	if policy != nil {
+		policy.OnGet(key, inMemItem)
 	}
-	return nil, hafezieh.ErrMiss
+	return inMemItem, cas, nil
 }
 
 func (c *InMemoryCache) Del(key string) error {
 	c.mutex.Lock()
-	delete(c.items, key)
-	c.mutex.Unlock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return hafezieh.ErrClosed
+	}
+	c.deleteItem(key)
 	return nil
 }
 
+// Remove is like Del, but returns the value of the deleted key, or
+// hafezieh.ErrMiss if it wasn't available. The negative items are deleted
+// too, as not available.
+func (c *InMemoryCache) Remove(key string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil, hafezieh.ErrClosed
+	}
+	inMemItem, found := c.positiveItem(key)
+	c.deleteItem(key)
+	if !found {
+		return nil, hafezieh.ErrMiss
+	}
+	return inMemItem.Item, nil
+}
+
+// Flush deletes all the items, and drops their scheduled revisits
+func (c *InMemoryCache) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return hafezieh.ErrClosed
+	}
+	c.items = make(map[string]*InMemItem)
+	c.keys = radixTree{}
+	c.tags = nil
+	c.negatives = make(map[string]struct{})
+	if c.revisitTimeQMan != nil {
+		c.revisitTimeQMan.Reset()
+	}
+	if c.policy != nil {
+		c.policy.Reset()
+	}
+	return nil
+}
+
+// Close stops the janitor and the revisit workers, and waits for them
 func (c *InMemoryCache) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown is like Close, but gives up waiting for the background goroutines
+// when ctx is done, and returns ctx.Err(). The goroutines are stopped anyway.
+func (c *InMemoryCache) Shutdown(ctx context.Context) error {
+	c.mutex.Lock()
+	if !c.closed {
+		c.closed = true
+		go c.stopBackground()
+	}
+	c.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *InMemoryCache) stopBackground() {
+	c.reconfigureMutex.Lock()
+	defer c.reconfigureMutex.Unlock()
+	if c.janitor != nil {
+		c.janitor.stop()
+	}
 	if c.revisitTimeQMan != nil {
 		c.revisitTimeQMan.Close()
 	}
-	c.janitor.stop()
-	return nil
+	close(c.done)
 }
 
 func (c *InMemoryCache) callRevisit(inMemKey *InMemKey) {
-	revisitFunc := c.config.RevisitFunc
-	if revisitFunc == nil {
-		return
-	}
 	c.mutex.RLock()
-	if inMemItem, found := c.items[inMemKey.key]; found {
+	inMemItem, found := c.items[inMemKey.key]
+	if !found || inMemItem.revisitTime == nil || *inMemItem.revisitTime != inMemKey.revisitTime {
+		// Deleted, or an old hook
 		c.mutex.RUnlock()
-		if inMemItem.revisitTime != nil && *inMemItem.revisitTime == inMemKey.revisitTime {
-			// Not an old hook
-			revisitFunc(c, inMemKey.key, inMemItem)
-		}
 		return
 	}
+	revisitFunc := inMemItem.revisitFunc
+	if revisitFunc == nil {
+		revisitFunc = c.config.RevisitFunc
+	}
+	snapshot := inMemItem.snapshot()
 	c.mutex.RUnlock()
+
+	if revisitFunc == nil {
+		return
+	}
+	decision := revisitFunc(c, inMemKey.key, &snapshot)
+	c.applyRevisitDecision(inMemKey.key, inMemItem, decision)
+}
+
+func (c *InMemoryCache) applyRevisitDecision(key string, inMemItem *InMemItem, decision RevisitDecision) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.items[key] != inMemItem {
+		// Reset or deleted during the revisit
+		return
+	}
+	n := time.Now()
+	switch decision.Action {
+	case RevisitKeep:
+	case RevisitDelete:
+		c.deleteItem(key)
+	case RevisitReplace:
+		var revisitTime *time.Time
+		if decision.After > 0 {
+			r := n.Add(decision.After)
+			revisitTime = &r
+		}
+		c.storeItem(key, &InMemItem{
+			Item:        decision.Value,
+			CreatedAt:   n,
+			LastAccess:  inMemItem.LastAccessed(),
+			Hits:        inMemItem.HitCount(),
+			revisitTime: revisitTime,
+			revisitFunc: inMemItem.revisitFunc,
+			tags:        inMemItem.tags,
+		})
+	case RevisitReschedule:
+		after := decision.After
+		if after <= 0 {
+			after = c.config.RevisitDefaultDuration
+		}
+		if after <= 0 {
+			inMemItem.revisitTime = nil
+			return
+		}
+		r := n.Add(after)
+		inMemItem.revisitTime = &r
+		c.scheduleRevisit(key, inMemItem)
+	default:
+		c.logger.Warn("unknown revisit action", "key", key, "action", decision.Action)
+	}
 }
 
 func NewMemoryCache(config *InMemoryCacheConfig) (hafezieh.Cache, error) {
@@ -148,17 +455,24 @@ func NewMemoryCache(config *InMemoryCacheConfig) (hafezieh.Cache, error) {
 	c := &InMemoryCache{
 		config: config,
 
-		items: make(map[string]*InMemItem),
-	}
-	if c.config.RevisitNumberOfWorkers > 0 {
-		c.revisitTimeQMan = initRevisitTimeQueueManager(&c.mutex, config.RevisitClock, config.RevisitNumberOfWorkers, c.callRevisit)
+		items:     make(map[string]*InMemItem),
+		negatives: make(map[string]struct{}),
+		done:      make(chan struct{}),
+		logger:    config.logger(),
+		quotas:    make(map[string]uint64),
 	}
-
 	if c.config.Cleanup != nil {
+		c.setQuotas(c.config.Cleanup.NamespaceQuotas)
 		c.janitor, err = newJanitor(c.config.Cleanup, c)
 		if err != nil {
 			return nil, err
 		}
+		c.policy = c.janitor.policy
+	}
+
+	if c.config.RevisitNumberOfWorkers > 0 {
+		c.revisitTimeQMan = initRevisitTimeQueueManager(
+			&c.mutex, config.RevisitClock, config.RevisitNumberOfWorkers, config.RevisitDrainOnClose, c.logger, c.callRevisit)
 	}
 
 	return c, nil
@@ -1,6 +1,8 @@
 package inmemory
 
 import (
+	"container/heap"
+	"context"
 	"testing"
 	"time"
 
@@ -36,3 +38,227 @@ func TestMemoryEngine(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRevisitDecisions(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{RevisitFunc: ExpireRevisitFunc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(*InMemoryCache)
+	revisit := func(key string) {
+		c.mutex.RLock()
+		inMemItem := c.items[key]
+		c.mutex.RUnlock()
+		c.callRevisit(&InMemKey{key, *inMemItem.revisitTime})
+	}
+
+	err = c.Set("expire", 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisit("expire")
+	if _, err := c.Get("expire"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+
+	err = c.SetWithOptions("replace", 1, &SetOptions{
+		RevisitDuration: time.Minute,
+		RevisitFunc: func(cache hafezieh.Cache, key string, item *InMemItem) RevisitDecision {
+			return RevisitDecision{Action: RevisitReplace, Value: item.Item.(int) + 1, After: time.Minute}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisit("replace")
+	revisit("replace")
+	if val, err := c.Get("replace"); err != nil || val != 3 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+
+	err = c.SetWithOptions("reschedule", 1, &SetOptions{
+		RevisitDuration: time.Minute,
+		RevisitFunc: func(cache hafezieh.Cache, key string, item *InMemItem) RevisitDecision {
+			return RevisitDecision{Action: RevisitReschedule, After: time.Hour}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisit("reschedule")
+	c.mutex.RLock()
+	inMemItem := c.items["reschedule"]
+	c.mutex.RUnlock()
+	if inMemItem == nil || inMemItem.revisitTime.Sub(inMemItem.CreatedAt) < time.Hour {
+		t.Fatalf("Unexpected item after reschedule: %v", inMemItem)
+	}
+
+	err = c.Set("reset", 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mutex.RLock()
+	oldKey := &InMemKey{"reset", *c.items["reset"].revisitTime}
+	c.mutex.RUnlock()
+	err = c.Set("reset", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.callRevisit(oldKey)
+	if val, err := c.Get("reset"); err != nil || val != 2 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+}
+
+func TestSetDefaultRevisitDuration(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{RevisitDefaultDuration: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Set("t1", 1, hafezieh.UseDefaultValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.(*InMemoryCache).items["t1"].revisitTime == nil {
+		t.Fatal("Expected the default revisit duration to be used")
+	}
+	if err = d.Set("t2", 1, -2); err != hafezieh.ErrNegativeDuration {
+		t.Fatal("expecting ErrNegativeDuration, got:", err)
+	}
+	if err = d.Set("t3", 1, time.Second); err != ErrSmallDuration {
+		t.Fatal("expecting ErrSmallDuration, got:", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		RevisitFunc:            ExpireRevisitFunc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(*InMemoryCache)
+	c.SetWithTags("t1", 1, time.Minute, "tag")
+	c.Set("t2", 2, time.Minute)
+	err = d.(hafezieh.Flusher).Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("t1"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	c.mutex.RLock()
+	if len(c.items) != 0 || c.keys.size != 0 || len(c.tags) != 0 || len(c.revisitTimeQMan.revisitTimeQ) != 0 {
+		t.Fatal("unexpected leftovers after Flush")
+	}
+	c.mutex.RUnlock()
+	if err := c.Set("t1", 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := c.Get("t1"); err != nil || val != 3 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		RevisitFunc:            ExpireRevisitFunc,
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedLRU,
+			NumberOfItemsTarget: 10,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set("t1", 1, time.Minute)
+	start := time.Now()
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("Close took too long:", elapsed)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get("t1"); err != hafezieh.ErrClosed {
+		t.Fatal("expecting ErrClosed, got:", err)
+	}
+	if err := d.Set("t1", 1, 0); err != hafezieh.ErrClosed {
+		t.Fatal("expecting ErrClosed, got:", err)
+	}
+	if err := d.Del("t1"); err != hafezieh.ErrClosed {
+		t.Fatal("expecting ErrClosed, got:", err)
+	}
+
+	// Without the background goroutines
+	d, err = NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	d, err := NewMemoryCache(&InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		RevisitDrainOnClose:    true,
+		RevisitFunc: func(cache hafezieh.Cache, key string, item *InMemItem) RevisitDecision {
+			<-release
+			return RevisitDecision{Action: RevisitDelete}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(*InMemoryCache)
+	c.Set("t1", 1, 5*time.Second)
+	// Assigning the revisit to the worker, without waiting for it
+	c.mutex.Lock()
+	c.revisitTimeQMan.jobs <- heap.Pop(&c.revisitTimeQMan.revisitTimeQ).(*InMemKey)
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal("expecting DeadlineExceeded, got:", err)
+	}
+	close(release)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if _, found := c.items["t1"]; found {
+		t.Fatal("expected the pending revisit to be drained")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	c := d.(*InMemoryCache)
+	c.Set("t1", 1, 0)
+	c.SetNegative("t2", nil, 0)
+	if x, err := c.Remove("t1"); err != nil || x != 1 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", x, err)
+	}
+	if _, err := c.Remove("t1"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	if _, err := c.Remove("t2"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	if stats := c.Stats(); stats.Items != 0 || stats.NegativeItems != 0 || stats.Hits != 0 || stats.Misses != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
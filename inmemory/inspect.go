@@ -0,0 +1,91 @@
+package inmemory
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Inspect returns a copy of the item of the key, including the negative and
+// the expired ones, without counting it as a hit or an access
+func (c *InMemoryCache) Inspect(key string) (InMemItem, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closed {
+		return InMemItem{}, hafezieh.ErrClosed
+	}
+	inMemItem, found := c.items[key]
+	if !found {
+		return InMemItem{}, hafezieh.ErrMiss
+	}
+	return inMemItem.snapshot(), nil
+}
+
+// Config returns a copy of the current config
+func (c *InMemoryCache) Config() InMemoryCacheConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	config := *c.config
+	if config.Cleanup != nil {
+		cleanup := *config.Cleanup
+		config.Cleanup = &cleanup
+	}
+	return config
+}
+
+// snapshot returns a copy of the item, with up to date LastAccess and Hits.
+// c.mutex should be read-locked by the caller.
+func (i *InMemItem) snapshot() InMemItem {
+	return InMemItem{
+		Item:        i.Item,
+		CreatedAt:   i.CreatedAt,
+		LastAccess:  i.LastAccessed(),
+		Hits:        i.HitCount(),
+		index:       i.index,
+		revisitTime: i.revisitTime,
+		revisitFunc: i.revisitFunc,
+		cas:         i.cas,
+		tags:        i.tags,
+		negative:    i.negative,
+		err:         i.err,
+		expiresAt:   i.expiresAt,
+	}
+}
+
+// LastAccessed returns the time of the last Get of the item. Unlike
+// LastAccess, it is up to date on the live items, e.g. the ones passed to an
+// EvictionPolicy.
+func (i *InMemItem) LastAccessed() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&i.lastAccess))
+}
+
+// HitCount returns the number of the Gets of the item. Unlike Hits, it is up
+// to date on the live items.
+func (i *InMemItem) HitCount() uint {
+	return uint(atomic.LoadUint64(&i.hits))
+}
+
+// RevisitTime returns the time of the scheduled revisit of the item, if any
+func (i *InMemItem) RevisitTime() (time.Time, bool) {
+	if i.revisitTime == nil {
+		return time.Time{}, false
+	}
+	return *i.revisitTime, true
+}
+
+// Negative returns whether the item is set by SetNegative, and its error
+func (i *InMemItem) Negative() (bool, error) {
+	return i.negative, i.err
+}
+
+// ExpiresAt returns the expiration time of a negative item, which is zero if
+// it never expires
+func (i *InMemItem) ExpiresAt() time.Time {
+	return i.expiresAt
+}
+
+// Tags returns the tags of the item
+func (i *InMemItem) Tags() []string {
+	return append([]string(nil), i.tags...)
+}
@@ -0,0 +1,86 @@
+package inmemory
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestInspect(t *testing.T) {
+	cache, err := NewMemoryCache(&InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedLRU,
+			NumberOfItemsTarget: 10,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	c := cache.(*InMemoryCache)
+	c.SetWithTags("a", 1, time.Minute, "t")
+	errNotFound := errors.New("not found")
+	c.SetNegative("b", errNotFound, 0)
+
+	item, err := c.Inspect("a")
+	if err != nil || item.Item != 1 || item.Hits != 0 {
+		t.Fatal("unexpected item:", item, err)
+	}
+	if revisitTime, ok := item.RevisitTime(); !ok || time.Until(revisitTime) > time.Minute {
+		t.Fatal("unexpected revisit time:", revisitTime, ok)
+	}
+	if tags := item.Tags(); len(tags) != 1 || tags[0] != "t" {
+		t.Fatal("unexpected tags:", tags)
+	}
+	item, err = c.Inspect("b")
+	if negative, itemErr := item.Negative(); err != nil || !negative || itemErr != errNotFound {
+		t.Fatal("unexpected negative item:", item, err)
+	}
+	if _, err := c.Inspect("c"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.ScheduledRevisits != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	config := c.Config()
+	config.Cleanup.NumberOfItemsTarget = 1
+	if c.config.Cleanup.NumberOfItemsTarget != 10 {
+		t.Fatal("Config doesn't return a copy")
+	}
+}
+
+func TestInspectDuringGets(t *testing.T) {
+	cache, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	c := cache.(*InMemoryCache)
+	c.Set("a", 1, 0)
+	before := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Get("a")
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		c.Inspect("a")
+	}
+	wg.Wait()
+
+	item, err := c.Inspect("a")
+	if err != nil || item.Hits != 400 || item.LastAccess.Before(before) {
+		t.Fatal("unexpected item:", item, err)
+	}
+}
@@ -0,0 +1,84 @@
+package inmemory
+
+import (
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// SetWithTags is like Set, and attaches the tags to the key
+func (c *InMemoryCache) SetWithTags(key string, x interface{}, revisitDuration time.Duration, tags ...string) error {
+	return c.SetWithOptions(key, x, &SetOptions{
+		RevisitDuration: revisitDuration,
+		Tags:            tags,
+	})
+}
+
+// InvalidateTag deletes the keys which have the tag
+func (c *InMemoryCache) InvalidateTag(tag string) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return 0, hafezieh.ErrClosed
+	}
+	keys := c.tags[tag]
+	n := len(keys)
+	for key := range keys {
+		c.deleteItem(key)
+	}
+	return n, nil
+}
+
+// DelPrefix deletes the keys starting with prefix, and returns the number of
+// the deleted items, except the negative ones
+func (c *InMemoryCache) DelPrefix(prefix string) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return 0, hafezieh.ErrClosed
+	}
+	keys := []string{}
+	c.keys.walkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	n := len(keys)
+	for _, key := range keys {
+		if _, negative := c.negatives[key]; negative {
+			n--
+		}
+		c.deleteItem(key)
+	}
+	return n, nil
+}
+
+// tag adds the key to the index of its tags. c.mutex should be locked by the
+// caller.
+func (c *InMemoryCache) tag(key string, inMemItem *InMemItem) {
+	if len(inMemItem.tags) == 0 {
+		return
+	}
+	if c.tags == nil {
+		c.tags = make(map[string]map[string]struct{})
+	}
+	for _, tag := range inMemItem.tags {
+		keys, found := c.tags[tag]
+		if !found {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// untag removes the key from the index of its tags. c.mutex should be locked
+// by the caller.
+func (c *InMemoryCache) untag(key string, inMemItem *InMemItem) {
+	for _, tag := range inMemItem.tags {
+		keys := c.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package inmemory
+
+import (
+	"testing"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(hafezieh.TagInvalidator)
+	c.SetWithTags("profile:1", 1, 0, "user:1")
+	c.SetWithTags("avatar:1", 1, 0, "user:1", "avatars")
+	c.SetWithTags("avatar:2", 2, 0, "user:2", "avatars")
+	c.SetWithTags("avatar:3", 3, 0, "user:3", "avatars")
+	// Resetting without the tags
+	c.Set("avatar:3", 3, 0)
+
+	n, err := c.InvalidateTag("user:1")
+	if err != nil || n != 2 {
+		t.Fatalf("Unexpected results. n=%v  err=%v", n, err)
+	}
+	if _, err := c.Get("avatar:1"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	n, err = c.InvalidateTag("avatars")
+	if err != nil || n != 1 {
+		t.Fatalf("Unexpected results. n=%v  err=%v", n, err)
+	}
+	if _, err := c.Get("avatar:3"); err != nil {
+		t.Fatal(err)
+	}
+	if tags := d.(*InMemoryCache).tags; len(tags) != 0 {
+		t.Fatal("unexpected tags:", tags)
+	}
+}
+
+func TestDelPrefix(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(hafezieh.PrefixDeleter)
+	for _, key := range []string{"user:1", "user:1:avatar", "user:2", "post:1"} {
+		c.Set(key, key, 0)
+	}
+	n, err := c.DelPrefix("user:1")
+	if err != nil || n != 2 {
+		t.Fatalf("Unexpected results. n=%v  err=%v", n, err)
+	}
+	if _, err := c.Get("user:1:avatar"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	if _, err := c.Get("user:2"); err != nil {
+		t.Fatal(err)
+	}
+	n, err = c.DelPrefix("")
+	if err != nil || n != 2 {
+		t.Fatalf("Unexpected results. n=%v  err=%v", n, err)
+	}
+}
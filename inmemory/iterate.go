@@ -0,0 +1,58 @@
+package inmemory
+
+import (
+	"sort"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Range calls fn for each item except the negative ones, until it returns
+// false. The items are a snapshot taken before the first call, so fn may call
+// the cache, but changes made after the snapshot are not visited. item is a
+// copy, and changing it doesn't affect the cache.
+func (c *InMemoryCache) Range(fn func(key string, item *InMemItem) bool) {
+	c.mutex.RLock()
+	keys := make([]string, 0, len(c.items))
+	items := make([]InMemItem, 0, len(c.items))
+	for key, inMemItem := range c.items {
+		if inMemItem.negative {
+			continue
+		}
+		keys = append(keys, key)
+		items = append(items, inMemItem.snapshot())
+	}
+	c.mutex.RUnlock()
+	for i := range keys {
+		if !fn(keys[i], &items[i]) {
+			return
+		}
+	}
+}
+
+// Keys returns the keys starting with prefix, sorted, except the ones of the
+// negative items
+func (c *InMemoryCache) Keys(prefix string) ([]string, error) {
+	keys := []string{}
+	c.mutex.RLock()
+	if c.closed {
+		c.mutex.RUnlock()
+		return nil, hafezieh.ErrClosed
+	}
+	c.keys.walkPrefix(prefix, func(key string) bool {
+		if _, negative := c.negatives[key]; !negative {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	c.mutex.RUnlock()
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Len returns the number of the items, except the negative ones
+func (c *InMemoryCache) Len() int {
+	c.mutex.RLock()
+	n := len(c.items) - len(c.negatives)
+	c.mutex.RUnlock()
+	return n
+}
@@ -0,0 +1,91 @@
+package inmemory
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestRangeKeysLen(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(*InMemoryCache)
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("user:%d", i), i, 0)
+	}
+	c.Set("post:1", 1, 0)
+
+	if n := d.(hafezieh.SizedCache).Len(); n != 11 {
+		t.Fatal("unexpected len:", n)
+	}
+	keys, err := d.(hafezieh.KeyLister).Keys("user:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[user:0 user:1 user:2 user:3 user:4 user:5 user:6 user:7 user:8 user:9]" {
+		t.Fatal("unexpected keys:", keys)
+	}
+
+	sum := 0
+	c.Range(func(key string, item *InMemItem) bool {
+		// Modifying the cache while ranging
+		c.Del(key)
+		sum += item.Item.(int)
+		return true
+	})
+	if sum != 46 {
+		t.Fatal("unexpected sum:", sum)
+	}
+	if n := c.Len(); n != 0 {
+		t.Fatal("unexpected len:", n)
+	}
+
+	c.Set("t1", 1, 0)
+	c.Set("t2", 2, 0)
+	visited := 0
+	c.Range(func(key string, item *InMemItem) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatal("unexpected number of visits:", visited)
+	}
+}
+
+func TestRangeAccessStats(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	c := d.(*InMemoryCache)
+	c.Set("a", 1, 0)
+	created := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Get("a")
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		c.Range(func(key string, item *InMemItem) bool { return true })
+	}
+	wg.Wait()
+
+	c.Range(func(key string, item *InMemItem) bool {
+		if item.Hits != 400 || !item.LastAccess.After(created) {
+			t.Fatalf("unexpected access stats: %d, %v", item.Hits, item.LastAccess)
+		}
+		return true
+	})
+}
@@ -0,0 +1,34 @@
+package inmemory
+
+import (
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Namespace returns hafezieh.Namespace(c, name), and sets the quota of the
+// namespace, if it's >0. The quotas are applied by the janitor, so they need
+// a Cleanup config.
+func (c *InMemoryCache) Namespace(name string, quota uint64) hafezieh.Cache {
+	if quota > 0 {
+		c.SetNamespaceQuota(name, quota)
+	}
+	return hafezieh.Namespace(c, name)
+}
+
+// SetNamespaceQuota limits the number of items of the namespace, like
+// InMemoryCleanupConfig.NamespaceQuotas. 0 removes the quota.
+func (c *InMemoryCache) SetNamespaceQuota(name string, quota uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setQuotas(map[string]uint64{name: quota})
+}
+
+// setQuotas adds the quotas. c.mutex should be locked by the caller.
+func (c *InMemoryCache) setQuotas(quotas map[string]uint64) {
+	for name, quota := range quotas {
+		if quota == 0 {
+			delete(c.quotas, name)
+		} else {
+			c.quotas[name] = quota
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package inmemory
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestNamespaceQuota(t *testing.T) {
+	cache, err := NewMemoryCache(&InMemoryCacheConfig{
+		Cleanup: &InMemoryCleanupConfig{
+			NamespaceQuotas: map[string]uint64{"billing": 3},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	c := cache.(*InMemoryCache)
+	billing := hafezieh.Namespace(c, "billing")
+	users := c.Namespace("users", 2)
+	n := time.Now()
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		billing.Set(key, i, 0)
+		users.Set(key, i, 0)
+		c.items["billing:"+key].lastAccess = n.Add(time.Duration(i) * time.Second).UnixNano()
+		c.items["users:"+key].lastAccess = n.Add(time.Duration(i) * time.Second).UnixNano()
+	}
+	c.Set("other", 1, 0)
+
+	c.janitor.cleanup(c)
+	if c.Len() != 6 {
+		t.Fatal("unexpected Len:", c.Len())
+	}
+	keys, _ := billing.(hafezieh.KeyLister).Keys("")
+	if fmt.Sprint(keys) != "[user:2 user:3 user:4]" {
+		t.Fatal("unexpected billing keys:", keys)
+	}
+	keys, _ = users.(hafezieh.KeyLister).Keys("")
+	if fmt.Sprint(keys) != "[user:3 user:4]" {
+		t.Fatal("unexpected users keys:", keys)
+	}
+
+	if err := users.(hafezieh.Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 4 {
+		t.Fatal("unexpected Len after flushing a namespace:", c.Len())
+	}
+
+	c.SetNamespaceQuota("billing", 0)
+	billing.Set("user:5", 5, 0)
+	c.janitor.cleanup(c)
+	if keys, _ := billing.(hafezieh.KeyLister).Keys(""); len(keys) != 4 {
+		t.Fatal("the removed quota is applied:", keys)
+	}
+}
@@ -0,0 +1,90 @@
+package inmemory
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// SetNegative stores a negative item, which makes Get return err (or
+// hafezieh.ErrMiss if err is nil) until ttl passes. UseDefaultValue means
+// NegativeDefaultDuration, and 0 means no expiration. The negative items are
+// sized separately: they are not counted as hits, not returned by Len, Keys
+// and Range, and not evicted by the cleanup mechanism or counted in its
+// targets and the namespace quotas. If the number of them reaches
+// NegativeNumberOfItemsTarget, new ones are not stored.
+func (c *InMemoryCache) SetNegative(key string, err error, ttl time.Duration) error {
+	if err == nil {
+		err = hafezieh.ErrMiss
+	}
+	n := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return hafezieh.ErrClosed
+	}
+	if ttl == hafezieh.UseDefaultValue {
+		ttl = c.config.NegativeDefaultDuration
+	}
+	if ttl < 0 {
+		return hafezieh.ErrNegativeDuration
+	}
+	inMemItem := &InMemItem{
+		CreatedAt:  n,
+		LastAccess: n,
+		negative:   true,
+		err:        err,
+	}
+	if ttl > 0 {
+		inMemItem.expiresAt = n.Add(ttl)
+	}
+	if target := c.config.NegativeNumberOfItemsTarget; target > 0 {
+		if _, found := c.negatives[key]; !found && len(c.negatives) >= target {
+			c.expireNegatives(n)
+			if len(c.negatives) >= target {
+				return nil
+			}
+		}
+	}
+	c.storeItem(key, inMemItem)
+	return nil
+}
+
+// negativeError returns the error of the negative item, or hafezieh.ErrMiss
+// if it's expired
+func (c *InMemoryCache) negativeError(key string, inMemItem *InMemItem) error {
+	if !inMemItem.expiresAt.IsZero() && time.Now().After(inMemItem.expiresAt) {
+		c.mutex.Lock()
+		if c.items[key] == inMemItem {
+			c.deleteItem(key)
+		}
+		c.mutex.Unlock()
+		atomic.AddUint64(&c.counters.misses, 1)
+		return hafezieh.ErrMiss
+	}
+	atomic.AddUint64(&c.counters.negativeHits, 1)
+	return inMemItem.err
+}
+
+// positiveItem returns the item of the key, unless it's negative. c.mutex
+// should be locked by the caller.
+func (c *InMemoryCache) positiveItem(key string) (*InMemItem, bool) {
+	inMemItem, found := c.items[key]
+	if !found || inMemItem.negative {
+		return nil, false
+	}
+	return inMemItem, true
+}
+
+// expireNegatives deletes the expired negative items. c.mutex should be
+// locked by the caller.
+func (c *InMemoryCache) expireNegatives(n time.Time) {
+	for key := range c.negatives {
+		inMemItem := c.items[key]
+		if !inMemItem.expiresAt.IsZero() && n.After(inMemItem.expiresAt) {
+			c.deleteItem(key)
+		}
+	}
+}
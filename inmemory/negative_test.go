@@ -0,0 +1,103 @@
+package inmemory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestSetNegative(t *testing.T) {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{
+		NegativeDefaultDuration:     time.Minute,
+		NegativeNumberOfItemsTarget: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.(hafezieh.NegativeCache)
+	errLoader := errors.New("loader failed")
+
+	if err := c.SetNegative("missing", nil, hafezieh.UseDefaultValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetNegative("failed", errLoader, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("missing"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+	if _, err := c.Get("failed"); err != errLoader {
+		t.Fatal("expecting errLoader, got:", err)
+	}
+	// Reached NegativeNumberOfItemsTarget
+	if err := c.SetNegative("third", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := d.(*InMemoryCache).Stats().NegativeItems; n != 2 {
+		t.Fatal("unexpected number of negative items:", n)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, err := c.Get("failed"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss after expiration, got:", err)
+	}
+	// There is room for a new one after the expiration
+	if err := c.SetNegative("third", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Counters treat the negative items as missing
+	if val, err := c.(hafezieh.CounterCache).Incr("missing", 1); err != nil || val != 1 {
+		t.Fatalf("Unexpected results. val=%v  err=%v", val, err)
+	}
+
+	stats := d.(*InMemoryCache).Stats()
+	expected := InMemoryCacheStats{Items: 1, Misses: 1, NegativeItems: 1, NegativeHits: 2}
+	if stats != expected {
+		t.Fatalf("unexpected stats: %+v != %+v", stats, expected)
+	}
+}
+
+func TestNegativeSizedSeparately(t *testing.T) {
+	for _, mechanism := range []CleanupMechanism{CleanupNumberBasedLRU, CleanupNumberBasedLFU, CleanupNumberBasedARC, CleanupNumberBasedWTinyLFU} {
+		d, err := NewMemoryCache(&InMemoryCacheConfig{
+			Cleanup: &InMemoryCleanupConfig{
+				Mechanism:           mechanism,
+				NumberOfItemsTarget: 2,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := d.(*InMemoryCache)
+		c.Set("a", 1, 0)
+		c.Set("b", 2, 0)
+		c.SetNegative("c", nil, 0)
+		c.SetNegative("d", nil, 0)
+		// Replaces a positive item
+		c.Set("e", 5, 0)
+		c.SetNegative("e", nil, 0)
+
+		if n := c.Len(); n != 2 {
+			t.Fatalf("%v: unexpected len: %d", mechanism, n)
+		}
+		if keys, _ := c.Keys(""); len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+			t.Fatalf("%v: unexpected keys: %v", mechanism, keys)
+		}
+		c.janitor.cleanup(c)
+		for _, key := range []string{"a", "b"} {
+			if _, err := c.Get(key); err != nil {
+				t.Fatalf("%v: %s evicted because of the negative items: %v", mechanism, key, err)
+			}
+		}
+		if n, err := c.DelPrefix(""); err != nil || n != 2 {
+			t.Fatalf("%v: unexpected DelPrefix results: %d, %v", mechanism, n, err)
+		}
+		if n := c.Stats().NegativeItems; n != 0 {
+			t.Fatalf("%v: unexpected negative items after DelPrefix: %d", mechanism, n)
+		}
+		c.Close()
+	}
+}
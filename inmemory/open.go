@@ -0,0 +1,56 @@
+package inmemory
+
+import (
+	"net/url"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/config"
+)
+
+// cleanupSettings are the query parameters of the URL, which are passed to
+// InMemoryCleanupConfig
+var cleanupSettings = map[string]bool{
+	"mechanism":     true,
+	"clock":         true,
+	"heap-target":   true,
+	"number-target": true,
+	"percent":       true,
+}
+
+func init() {
+	hafezieh.Register("inmemory", OpenURL)
+}
+
+// OpenURL builds an InMemoryCache from a URL like
+// "inmemory://?number-target=10000&revisit-default-duration=5m". The query
+// parameters are the mapstructure names of InMemoryCacheConfig and
+// InMemoryCleanupConfig. If a heap-target or number-target is set without a
+// mechanism, CleanupHeapBasedLRU or CleanupNumberBasedLRU is used.
+func OpenURL(u *url.URL) (hafezieh.Cache, error) {
+	settings := map[string]interface{}{}
+	cleanup := map[string]interface{}{}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		if cleanupSettings[key] {
+			cleanup[key] = value
+		} else {
+			settings[key] = value
+		}
+	}
+	if _, found := cleanup["mechanism"]; !found {
+		if _, found := cleanup["number-target"]; found {
+			cleanup["mechanism"] = CleanupMechanism(CleanupNumberBasedLRU).String()
+		} else if _, found := cleanup["heap-target"]; found {
+			cleanup["mechanism"] = CleanupMechanism(CleanupHeapBasedLRU).String()
+		}
+	}
+	if len(cleanup) > 0 {
+		settings["cleanup"] = cleanup
+	}
+
+	c := &InMemoryCacheConfig{}
+	if err := config.Decode(settings, c); err != nil {
+		return nil, err
+	}
+	return NewMemoryCache(c)
+}
@@ -0,0 +1,35 @@
+package inmemory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestOpen(t *testing.T) {
+	cache, err := hafezieh.Open("inmemory://?number-target=10000&revisit-default-duration=5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	c := cache.(*InMemoryCache)
+	if c.config.RevisitDefaultDuration != 5*time.Minute {
+		t.Fatal("unexpected RevisitDefaultDuration:", c.config.RevisitDefaultDuration)
+	}
+	if c.config.Cleanup == nil || c.config.Cleanup.Mechanism != CleanupNumberBasedLRU ||
+		c.config.Cleanup.NumberOfItemsTarget != 10000 {
+		t.Fatalf("unexpected Cleanup: %+v", c.config.Cleanup)
+	}
+
+	if err := cache.Set("a", 1, hafezieh.UseDefaultValue); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := cache.Get("a"); err != nil || x != 1 {
+		t.Fatal("unexpected Get result:", x, err)
+	}
+
+	if _, err := hafezieh.Open("inmemory://?mechanism=heap-mru&unknown=1"); err == nil {
+		t.Fatal("expecting an error for the invalid options")
+	}
+}
@@ -0,0 +1,95 @@
+package inmemory
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// EvictionPolicy chooses the items to be removed by the janitor, based on the
+// accesses to the cache. It must be safe for concurrent use, and the items
+// passed to it must not be modified. The items are the live ones, so their
+// LastAccess and Hits are stale; LastAccessed and HitCount should be used
+// instead.
+type EvictionPolicy interface {
+	// OnSet is called when the key is set or updated, while the cache is
+	// locked
+	OnSet(key string, item *InMemItem)
+	// OnGet is called when the key is hit
+	OnGet(key string, item *InMemItem)
+	// OnDel is called when the key is deleted or removed, while the cache is
+	// locked
+	OnDel(key string)
+	// Victims returns (at most) n keys which should be removed
+	Victims(n int) []string
+	// Reset forgets all the keys, when the cache is flushed
+	Reset()
+}
+
+// lruPolicy chooses the least recently used items, based on LastAccess of the
+// items, so it doesn't need to track the accesses
+type lruPolicy struct {
+	janitor *janitor
+	cache   *InMemoryCache
+}
+
+func (p *lruPolicy) OnSet(key string, item *InMemItem) {}
+func (p *lruPolicy) OnGet(key string, item *InMemItem) {}
+func (p *lruPolicy) OnDel(key string)                  {}
+func (p *lruPolicy) Reset()                            {}
+
+func (p *lruPolicy) Victims(n int) []string {
+	pairs := p.janitor.leastRecentlyUsedPairs(p.janitor.generatePairs(p.cache), n)
+	keys := make([]string, len(pairs))
+	for i := range pairs {
+		keys[i] = pairs[i].key
+	}
+	return keys
+}
+
+type hitsKeyPair struct {
+	hits       uint
+	lastAccess int64
+	key        string
+}
+
+type lfuPairs []hitsKeyPair
+
+func (a lfuPairs) Len() int      { return len(a) }
+func (a lfuPairs) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a lfuPairs) Less(i, j int) bool {
+	if a[i].hits == a[j].hits {
+		return a[i].lastAccess < a[j].lastAccess
+	}
+	return a[i].hits < a[j].hits
+}
+
+// lfuPolicy chooses the least frequently used items, based on Hits of the
+// items, and the least recently used ones among the items with equal Hits
+type lfuPolicy struct {
+	cache *InMemoryCache
+}
+
+func (p *lfuPolicy) OnSet(key string, item *InMemItem) {}
+func (p *lfuPolicy) OnGet(key string, item *InMemItem) {}
+func (p *lfuPolicy) OnDel(key string)                  {}
+func (p *lfuPolicy) Reset()                            {}
+
+func (p *lfuPolicy) Victims(n int) []string {
+	p.cache.mutex.RLock()
+	pairs := make(lfuPairs, 0, len(p.cache.items)-len(p.cache.negatives))
+	for key, i := range p.cache.items {
+		if !i.negative {
+			pairs = append(pairs, hitsKeyPair{i.HitCount(), atomic.LoadInt64(&i.lastAccess), key})
+		}
+	}
+	p.cache.mutex.RUnlock()
+	if n > len(pairs) {
+		n = len(pairs)
+	}
+	sort.Sort(pairs)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = pairs[i].key
+	}
+	return keys
+}
@@ -0,0 +1,271 @@
+package inmemory
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+var traceFiles = flag.String("traces", "", "glob of the recorded traces (one key per line) for BenchmarkHitRatio")
+
+var comparedMechanisms = []struct {
+	name      string
+	mechanism CleanupMechanism
+}{
+	{"LRU", CleanupNumberBasedLRU},
+	{"LFU", CleanupNumberBasedLFU},
+	{"ARC", CleanupNumberBasedARC},
+	{"WTinyLFU", CleanupNumberBasedWTinyLFU},
+}
+
+// scanTrace generates a trace of zipf distributed accesses to a hot set,
+// which is interrupted by scans of never repeated keys, like a crawl
+func scanTrace(length int) []string {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 1, 5000)
+	trace := make([]string, 0, length)
+	scanned := 0
+	for len(trace) < length {
+		if len(trace)%5000 == 4999 {
+			for i := 0; i < 1000; i++ {
+				trace = append(trace, fmt.Sprintf("scan:%d", scanned))
+				scanned++
+			}
+			continue
+		}
+		trace = append(trace, fmt.Sprintf("hot:%d", zipf.Uint64()))
+	}
+	return trace
+}
+
+func loadTraces(tb testing.TB) map[string][]string {
+	traces := map[string][]string{"scan": scanTrace(30000)}
+	if *traceFiles == "" {
+		return traces
+	}
+	paths, err := filepath.Glob(*traceFiles)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		trace := []string{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			trace = append(trace, scanner.Text())
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			tb.Fatal(err)
+		}
+		traces[filepath.Base(path)] = trace
+	}
+	return traces
+}
+
+// simulateHitRatio replays the trace on a cache, which is cleaned up like the
+// janitor does, whenever it grows 5% larger than capacity
+func simulateHitRatio(tb testing.TB, mechanism CleanupMechanism, capacity int, trace []string) float64 {
+	d, err := NewMemoryCache(&InMemoryCacheConfig{
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           mechanism,
+			NumberOfItemsTarget: uint64(capacity),
+		},
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer d.Close()
+	c := d.(*InMemoryCache)
+	hits := 0
+	for _, key := range trace {
+		if _, err := c.Get(key); err == nil {
+			hits++
+			continue
+		} else if err != hafezieh.ErrMiss {
+			tb.Fatal(err)
+		}
+		c.Set(key, key, 0)
+		if c.Len() > capacity+capacity/20 {
+			c.janitor.cleanupFunc(c)
+			if n := c.Len(); n != capacity {
+				tb.Fatalf("%v: unexpected len after cleanup: %d", mechanism, n)
+			}
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestPoliciesOnScans(t *testing.T) {
+	trace := scanTrace(30000)
+	ratios := map[string]float64{}
+	for _, m := range comparedMechanisms {
+		ratios[m.name] = simulateHitRatio(t, m.mechanism, 500, trace)
+	}
+	t.Logf("hit ratios: %v", ratios)
+	if ratios["ARC"] <= ratios["LRU"] || ratios["WTinyLFU"] <= ratios["LRU"] {
+		t.Fatalf("expected ARC and W-TinyLFU to beat LRU on scans: %v", ratios)
+	}
+}
+
+func TestARCPolicy(t *testing.T) {
+	a := NewARCPolicy(4).(*arcPolicy)
+	a.OnSet("hot", nil)
+	a.OnGet("hot", nil)
+	for i := 0; i < 4; i++ {
+		a.OnSet(fmt.Sprintf("scan:%d", i), nil)
+	}
+	victims := a.Victims(1)
+	if fmt.Sprint(victims) != "[scan:0]" {
+		t.Fatal("unexpected victims:", victims)
+	}
+	// A ghost hit moves the key to t2, and grows the target size of t1
+	a.OnSet("scan:0", nil)
+	if a.p != 1 || a.entries["scan:0"].Value.(*arcEntry).where != arcT2 {
+		t.Fatalf("unexpected state after ghost hit: p=%d", a.p)
+	}
+	a.OnDel("hot")
+	if _, found := a.entries["hot"]; found {
+		t.Fatal("expected hot to be forgotten")
+	}
+	a.Reset()
+	if len(a.Victims(10)) != 0 {
+		t.Fatal("expected no victims after reset")
+	}
+}
+
+func TestTinyLFUPolicy(t *testing.T) {
+	w := NewWTinyLFUPolicy(100).(*tinyLFUPolicy)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("hot:%d", i)
+		w.OnSet(key, nil)
+		for j := 0; j < 3; j++ {
+			w.OnGet(key, nil)
+		}
+	}
+	w.OnSet("once", nil)
+	// Making once the least recently used key of the window
+	w.OnGet("hot:99", nil)
+	victims := w.Victims(1)
+	if fmt.Sprint(victims) != "[once]" {
+		t.Fatal("unexpected victims:", victims)
+	}
+	if len(w.entries) != 100 {
+		t.Fatal("unexpected number of entries:", len(w.entries))
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(100)
+	for i := 0; i < 20; i++ {
+		s.increment("frequent")
+	}
+	s.increment("rare")
+	if e := s.estimate("frequent"); e != sketchMaxCounter {
+		t.Fatal("unexpected estimate:", e)
+	}
+	if e := s.estimate("rare"); e < 1 {
+		t.Fatal("unexpected estimate:", e)
+	}
+	s.reset()
+	if e := s.estimate("frequent"); e != sketchMaxCounter/2 {
+		t.Fatal("unexpected estimate after reset:", e)
+	}
+}
+
+func BenchmarkHitRatio(b *testing.B) {
+	for name, trace := range loadTraces(b) {
+		for _, m := range comparedMechanisms {
+			b.Run(name+"/"+m.name, func(b *testing.B) {
+				var ratio float64
+				for n := 0; n < b.N; n++ {
+					ratio = simulateHitRatio(b, m.mechanism, 500, trace)
+				}
+				b.ReportMetric(100*ratio, "hit%")
+			})
+		}
+	}
+}
+
+// fifoPolicy is an example of a policy implemented outside of the engine
+type fifoPolicy struct {
+	mutex sync.Mutex
+	keys  []string
+}
+
+func (p *fifoPolicy) OnSet(key string, item *InMemItem) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := range p.keys {
+		if p.keys[i] == key {
+			return
+		}
+	}
+	p.keys = append(p.keys, key)
+}
+
+func (p *fifoPolicy) OnGet(key string, item *InMemItem) {}
+
+func (p *fifoPolicy) OnDel(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := range p.keys {
+		if p.keys[i] == key {
+			p.keys = append(p.keys[:i], p.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *fifoPolicy) Victims(n int) []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if n > len(p.keys) {
+		n = len(p.keys)
+	}
+	return append([]string{}, p.keys[:n]...)
+}
+
+func (p *fifoPolicy) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.keys = nil
+}
+
+func TestCustomPolicy(t *testing.T) {
+	if err := (&InMemoryCleanupConfig{Mechanism: CleanupNumberBasedPolicy, NumberOfItemsTarget: 3}).validateAndSetDefaults(); err == nil {
+		t.Fatal("expected an error for the missing Policy")
+	}
+	d, err := NewMemoryCache(&InMemoryCacheConfig{
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedPolicy,
+			NumberOfItemsTarget: 2,
+			Policy:              &fifoPolicy{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	c := d.(*InMemoryCache)
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprintf("%d", i), i, 0)
+		c.Get(fmt.Sprintf("%d", i))
+	}
+	c.Del("3")
+	c.janitor.cleanupFunc(c)
+	keys, _ := c.Keys("")
+	if fmt.Sprint(keys) != "[2 4]" {
+		t.Fatal("unexpected keys:", keys)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/cafebazaar/hafezieh"
 )
 
 type InMemKey struct {
@@ -42,7 +42,9 @@ type revisitTimeQueueManager struct {
 	revisitTimeQ revisitTimeQueue
 	clock        time.Duration
 	jobs         chan *InMemKey
-	stop         bool
+	drain        bool
+	logger       hafezieh.Logger
+	stopCh       chan struct{}
 	wg           sync.WaitGroup
 }
 
@@ -50,57 +52,76 @@ func (m *revisitTimeQueueManager) Push(inMemKey *InMemKey) {
 	heap.Push(&m.revisitTimeQ, inMemKey)
 }
 
+// Reset drops all the scheduled revisits
+func (m *revisitTimeQueueManager) Reset() {
+	m.revisitTimeQ = revisitTimeQueue{}
+}
+
+// Close stops the assigner immediately, and waits for the workers. If drain
+// is set, the jobs which are already assigned are done, otherwise dropped.
+// Not designed to be called more than once.
 func (m *revisitTimeQueueManager) Close() {
-	m.stop = true
+	close(m.stopCh)
 	m.wg.Wait()
 }
 
-// Not designed to be run in parallel
+func (m *revisitTimeQueueManager) stopped() bool {
+	select {
+	case <-m.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// assignLoop sends the due revisits to the workers. The revisits are never
+// sent before their time, and are kept in the queue while the workers are
+// busy. Not designed to be run in parallel.
 func (m *revisitTimeQueueManager) assignLoop(mutex *sync.RWMutex) {
+	defer m.wg.Done()
+	defer close(m.jobs)
 	for {
-		if m.stop {
-			break
-		}
-		mutex.RLock()
-		n := len(m.revisitTimeQ)
-		var currentNext *InMemKey
-		if n == 0 {
-			mutex.RUnlock()
-			time.Sleep(m.clock)
-			continue
-		} else {
-			currentNext = m.revisitTimeQ[0]
-			mutex.RUnlock()
-		}
-		now := time.Now()
-		if currentNext.revisitTime.Sub(now) < m.clock {
-			mutex.Lock()
-			select {
-			case m.jobs <- heap.Pop(&m.revisitTimeQ).(*InMemKey):
-			default:
-				logrus.Warn("Dropping revisit, the queue is full.")
+		wait := m.clock
+		mutex.Lock()
+		// The queue may be reset in the mean time, so it's checked after
+		// locking
+		for len(m.revisitTimeQ) > 0 {
+			until := m.revisitTimeQ[0].revisitTime.Sub(time.Now())
+			if until > 0 {
+				if until < wait {
+					wait = until
+				}
+				break
 			}
-			mutex.Unlock()
-			continue
+			if len(m.jobs) == cap(m.jobs) {
+				// Retried when the workers are less busy
+				wait = m.clock / 100
+				break
+			}
+			m.jobs <- heap.Pop(&m.revisitTimeQ).(*InMemKey)
 		}
-		if m.stop {
-			break
+		mutex.Unlock()
+		select {
+		case <-m.stopCh:
+			return
+		case <-time.After(wait):
 		}
-		time.Sleep(m.clock)
 	}
-	close(m.jobs)
-	m.wg.Done()
 }
 
 func (m *revisitTimeQueueManager) startWorker(jobs <-chan *InMemKey, worker func(*InMemKey)) {
+	defer m.wg.Done()
 	for j := range jobs {
+		if !m.drain && m.stopped() {
+			continue
+		}
 		worker(j)
 	}
-	m.wg.Done()
 }
 
 func initRevisitTimeQueueManager(
-	mutex *sync.RWMutex, clock time.Duration, workerNum int, worker func(*InMemKey)) *revisitTimeQueueManager {
+	mutex *sync.RWMutex, clock time.Duration, workerNum int, drain bool, logger hafezieh.Logger,
+	worker func(*InMemKey)) *revisitTimeQueueManager {
 	if clock < time.Second {
 		clock = time.Second
 	}
@@ -109,6 +130,9 @@ func initRevisitTimeQueueManager(
 		revisitTimeQ: revisitTimeQueue{},
 		clock:        clock,
 		jobs:         make(chan *InMemKey, workerNum*10),
+		drain:        drain,
+		logger:       logger,
+		stopCh:       make(chan struct{}),
 	}
 	heap.Init(&manager.revisitTimeQ)
 	for i := 0; i < workerNum; i++ {
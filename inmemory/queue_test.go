@@ -5,13 +5,15 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/cafebazaar/hafezieh"
 )
 
 func workerNoop(*InMemKey) {}
 
 func TestRevisitTimeQueueManager(t *testing.T) {
 	var mutex sync.RWMutex
-	m := initRevisitTimeQueueManager(&mutex, 0, 0, workerNoop)
+	m := initRevisitTimeQueueManager(&mutex, 0, 0, false, hafezieh.NopLogger, workerNoop)
 	mutex.Lock()
 	m.Push(&InMemKey{"3", time.Date(2100, 1, 1, 1, 3, 1, 0, time.Local)})
 	mutex.Unlock()
@@ -57,3 +59,34 @@ func TestRevisitTimeQueueManager(t *testing.T) {
 		t.Fatalf("unexpected len: %v", m.revisitTimeQ)
 	}
 }
+
+func TestRevisitTimeQueueManagerTiming(t *testing.T) {
+	var mutex sync.RWMutex
+	due := time.Now().Add(300 * time.Millisecond)
+	var assigned []time.Time
+	done := make(chan struct{})
+	m := initRevisitTimeQueueManager(&mutex, time.Second, 1, false, hafezieh.NopLogger, func(k *InMemKey) {
+		assigned = append(assigned, time.Now())
+		if len(assigned) == 50 {
+			close(done)
+		}
+	})
+	defer m.Close()
+
+	mutex.Lock()
+	m.Push(&InMemKey{"due", due})
+	// More than the capacity of the jobs
+	for i := 0; i < 49; i++ {
+		m.Push(&InMemKey{"past", time.Now().Add(-time.Minute)})
+	}
+	mutex.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected no revisit to be dropped, got", len(assigned))
+	}
+	if last := assigned[len(assigned)-1]; last.Before(due) {
+		t.Fatal("revisited before its time:", due.Sub(last))
+	}
+}
@@ -0,0 +1,138 @@
+package inmemory
+
+import "strings"
+
+// radixTree is a compressed prefix tree of the keys, which makes the prefix
+// based operations proportional to the number of matching keys. The zero
+// value is an empty tree.
+type radixTree struct {
+	root radixNode
+	size int
+}
+
+type radixNode struct {
+	// prefix is the label of the edge from the parent
+	prefix   string
+	leaf     bool
+	children map[byte]*radixNode
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (t *radixTree) insert(key string) {
+	n := &t.root
+	for {
+		if len(key) == 0 {
+			if !n.leaf {
+				n.leaf = true
+				t.size++
+			}
+			return
+		}
+		child := n.children[key[0]]
+		if child == nil {
+			if n.children == nil {
+				n.children = make(map[byte]*radixNode)
+			}
+			n.children[key[0]] = &radixNode{prefix: key, leaf: true}
+			t.size++
+			return
+		}
+		l := commonPrefixLen(key, child.prefix)
+		if l < len(child.prefix) {
+			split := &radixNode{
+				prefix:   child.prefix[:l],
+				children: make(map[byte]*radixNode),
+			}
+			child.prefix = child.prefix[l:]
+			split.children[child.prefix[0]] = child
+			n.children[key[0]] = split
+			child = split
+		}
+		key = key[l:]
+		n = child
+	}
+}
+
+func (t *radixTree) delete(key string) {
+	var parent *radixNode
+	n := &t.root
+	for len(key) > 0 {
+		child := n.children[key[0]]
+		if child == nil || !strings.HasPrefix(key, child.prefix) {
+			return
+		}
+		key = key[len(child.prefix):]
+		parent, n = n, child
+	}
+	if !n.leaf {
+		return
+	}
+	n.leaf = false
+	t.size--
+	if parent == nil {
+		return
+	}
+	switch len(n.children) {
+	case 0:
+		delete(parent.children, n.prefix[0])
+		if parent != &t.root {
+			parent.mergeChild()
+		}
+	case 1:
+		n.mergeChild()
+	}
+}
+
+// mergeChild merges n with its only child, if n is not a leaf
+func (n *radixNode) mergeChild() {
+	if n.leaf || len(n.children) != 1 {
+		return
+	}
+	for _, child := range n.children {
+		n.prefix += child.prefix
+		n.leaf = child.leaf
+		n.children = child.children
+	}
+}
+
+// walkPrefix calls fn for the keys starting with prefix, until it returns
+// false. The tree must not be modified by fn.
+func (t *radixTree) walkPrefix(prefix string, fn func(key string) bool) {
+	n := &t.root
+	path := ""
+	for len(prefix) > 0 {
+		child := n.children[prefix[0]]
+		if child == nil {
+			return
+		}
+		if strings.HasPrefix(prefix, child.prefix) {
+			prefix = prefix[len(child.prefix):]
+		} else if strings.HasPrefix(child.prefix, prefix) {
+			prefix = ""
+		} else {
+			return
+		}
+		path += child.prefix
+		n = child
+	}
+	n.walk(path, fn)
+}
+
+func (n *radixNode) walk(path string, fn func(key string) bool) bool {
+	if n.leaf && !fn(path) {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.walk(path+child.prefix, fn) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package inmemory
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func radixKeys(t *radixTree, prefix string) []string {
+	keys := []string{}
+	t.walkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRadixTree(t *testing.T) {
+	tree := &radixTree{}
+	for _, key := range []string{"user:1", "user:10", "user:2", "use", "post:1", "", "user:1"} {
+		tree.insert(key)
+	}
+	if tree.size != 6 {
+		t.Fatal("unexpected size:", tree.size)
+	}
+	tests := map[string]string{
+		"user:1": "[user:1 user:10]",
+		"us":     "[use user:1 user:10 user:2]",
+		"user:3": "[]",
+		"post":   "[post:1]",
+		"x":      "[]",
+		"":       "[ post:1 use user:1 user:10 user:2]",
+	}
+	for prefix, expected := range tests {
+		if keys := fmt.Sprint(radixKeys(tree, prefix)); keys != expected {
+			t.Fatalf("unexpected keys for %q: %s != %s", prefix, keys, expected)
+		}
+	}
+
+	for _, key := range []string{"user:1", "use", "user:3", "", "post:1"} {
+		tree.delete(key)
+	}
+	if tree.size != 2 {
+		t.Fatal("unexpected size:", tree.size)
+	}
+	if keys := fmt.Sprint(radixKeys(tree, "")); keys != "[user:10 user:2]" {
+		t.Fatal("unexpected keys:", keys)
+	}
+	tree.delete("user:10")
+	tree.delete("user:2")
+	if tree.size != 0 || len(tree.root.children) != 0 {
+		t.Fatalf("expected an empty tree: %d %v", tree.size, tree.root.children)
+	}
+}
+
+func BenchmarkRadixTreeInsertDelete(b *testing.B) {
+	b.ReportAllocs()
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d:profile", i)
+	}
+	tree := &radixTree{}
+	for n := 0; n < b.N; n++ {
+		for _, key := range keys {
+			tree.insert(key)
+		}
+		for _, key := range keys {
+			tree.delete(key)
+		}
+	}
+}
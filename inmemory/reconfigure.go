@@ -0,0 +1,93 @@
+package inmemory
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Reconfigure applies config to the live cache, without losing the items.
+// The config is validated like NewMemoryCache, and the cache is left
+// untouched if it's invalid. The NamespaceQuotas of the config are added to
+// the current quotas. The revisit workers are replaced if their
+// settings are changed, and the janitor is always replaced by a new one,
+// whose policy is fed with the available items. The cleanup runs once before
+// returning, so the tightened limits are applied immediately.
+// Reconfigure must not be called from a CleanupFunc or a RevisitFunc.
+func (c *InMemoryCache) Reconfigure(config *InMemoryCacheConfig) error {
+	if err := config.validateAndSetDefaults(); err != nil {
+		return err
+	}
+
+	c.reconfigureMutex.Lock()
+	defer c.reconfigureMutex.Unlock()
+	c.mutex.RLock()
+	closed, old := c.closed, c.config
+	c.mutex.RUnlock()
+	if closed {
+		return hafezieh.ErrClosed
+	}
+
+	// The background goroutines are stopped before locking the cache, as they
+	// may be waiting for it
+	revisitChanged := old.RevisitNumberOfWorkers != config.RevisitNumberOfWorkers ||
+		old.RevisitClock != config.RevisitClock ||
+		old.RevisitDrainOnClose != config.RevisitDrainOnClose
+	if revisitChanged && c.revisitTimeQMan != nil {
+		c.revisitTimeQMan.Close()
+	}
+	if c.janitor != nil {
+		c.janitor.stop()
+	}
+
+	c.mutex.Lock()
+	c.config = config
+	c.logger = config.logger()
+	if revisitChanged {
+		c.revisitTimeQMan = nil
+		if config.RevisitNumberOfWorkers > 0 {
+			c.revisitTimeQMan = initRevisitTimeQueueManager(
+				&c.mutex, config.RevisitClock, config.RevisitNumberOfWorkers, config.RevisitDrainOnClose, c.logger, c.callRevisit)
+			for key, inMemItem := range c.items {
+				c.scheduleRevisit(key, inMemItem)
+			}
+		}
+	}
+	c.janitor, c.policy = nil, nil
+	var err error
+	if config.Cleanup != nil {
+		c.setQuotas(config.Cleanup.NamespaceQuotas)
+		c.janitor, err = newJanitor(config.Cleanup, c)
+		if err == nil && c.janitor.policy != nil {
+			c.policy = c.janitor.policy
+			c.policy.Reset()
+			c.feedPolicy()
+		}
+	}
+	j := c.janitor
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if j != nil {
+		j.cleanup(c)
+	}
+	return nil
+}
+
+// feedPolicy passes the available items to c.policy, from the least recently
+// used one. c.mutex should be locked by the caller.
+func (c *InMemoryCache) feedPolicy() {
+	pairs := make(lruPairs, 0, len(c.items))
+	for key, inMemItem := range c.items {
+		if !inMemItem.negative {
+			pairs = append(pairs, lastAccessKeyPair{atomic.LoadInt64(&inMemItem.lastAccess), key})
+		}
+	}
+	sort.Sort(pairs)
+	for _, pair := range pairs {
+		c.policy.OnSet(pair.key, c.items[pair.key])
+	}
+}
@@ -0,0 +1,128 @@
+package inmemory
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+func TestReconfigure(t *testing.T) {
+	cache, err := NewMemoryCache(&InMemoryCacheConfig{
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedLRU,
+			NumberOfItemsTarget: 100,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	c := cache.(*InMemoryCache)
+	n := time.Now()
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("%03d", i), i, 0)
+		c.items[fmt.Sprintf("%03d", i)].lastAccess = n.Add(time.Duration(i-100) * time.Second).UnixNano()
+	}
+
+	err = c.Reconfigure(&InMemoryCacheConfig{
+		Cleanup: &InMemoryCleanupConfig{Mechanism: CleanupNumberBasedLRU},
+	})
+	if err == nil {
+		t.Fatal("expecting an error for the invalid config")
+	}
+	if c.config.Cleanup.NumberOfItemsTarget != 100 {
+		t.Fatal("the invalid config is applied")
+	}
+
+	err = c.Reconfigure(&InMemoryCacheConfig{
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedLRU,
+			NumberOfItemsTarget: 10,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 10 {
+		t.Fatal("the tightened limit isn't applied, Len:", c.Len())
+	}
+	if _, err := c.Get("099"); err != nil {
+		t.Fatal("the most recently used item is deleted:", err)
+	}
+
+	err = c.Reconfigure(&InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		RevisitFunc:            ExpireRevisitFunc,
+		Cleanup: &InMemoryCleanupConfig{
+			Mechanism:           CleanupNumberBasedARC,
+			NumberOfItemsTarget: 5,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 5 {
+		t.Fatal("the new mechanism isn't applied, Len:", c.Len())
+	}
+	if _, err := c.Get("099"); err != nil {
+		t.Fatal("the most recently used item is deleted by the new policy:", err)
+	}
+	if c.revisitTimeQMan == nil {
+		t.Fatal("the revisit workers aren't started")
+	}
+	c.Set("revisited", 1, time.Minute)
+	c.mutex.RLock()
+	queued := len(c.revisitTimeQMan.revisitTimeQ)
+	c.mutex.RUnlock()
+	if queued != 1 {
+		t.Fatal("unexpected number of the scheduled revisits:", queued)
+	}
+
+	if err := c.Reconfigure(&InMemoryCacheConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if c.revisitTimeQMan != nil || c.janitor != nil || c.policy != nil {
+		t.Fatal("the background goroutines aren't removed")
+	}
+
+	c.Close()
+	if err := c.Reconfigure(&InMemoryCacheConfig{}); err != hafezieh.ErrClosed {
+		t.Fatal("expecting ErrClosed, got:", err)
+	}
+}
+
+func TestReconfigureConcurrently(t *testing.T) {
+	cache, err := NewMemoryCache(&InMemoryCacheConfig{RevisitNumberOfWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cache.(*InMemoryCache)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			c.Set(fmt.Sprint(i), i, time.Minute)
+			c.Del(fmt.Sprint(i / 2))
+		}
+	}()
+	for i := 1; i <= 5; i++ {
+		err := c.Reconfigure(&InMemoryCacheConfig{
+			RevisitNumberOfWorkers: i % 3,
+			Cleanup: &InMemoryCleanupConfig{
+				Mechanism:           CleanupNumberBasedWTinyLFU,
+				NumberOfItemsTarget: uint64(1000 - i*100),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
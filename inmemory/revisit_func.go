@@ -1,9 +1,40 @@
 package inmemory
 
-import "github.com/cafebazaar/hafezieh"
+import (
+	"time"
 
-type RevisitFunc func(cache hafezieh.Cache, key string, item *InMemItem)
+	"github.com/cafebazaar/hafezieh"
+)
 
-func ExpireRevisitFunc(cache hafezieh.Cache, key string, item *InMemItem) {
-	cache.Del(key)
+// RevisitAction tells the engine what to do with an item after its revisit
+type RevisitAction uint8
+
+const (
+	// RevisitKeep leaves the item untouched
+	RevisitKeep RevisitAction = iota
+	// RevisitDelete deletes the item
+	RevisitDelete
+	// RevisitReplace replaces the value of the item with RevisitDecision.Value
+	RevisitReplace
+	// RevisitReschedule revisits the item again after RevisitDecision.After
+	RevisitReschedule
+)
+
+// RevisitDecision is the result of a RevisitFunc. The engine applies it
+// atomically, unless the item is reset or deleted during the revisit.
+type RevisitDecision struct {
+	Action RevisitAction
+	// Value is the new value of the item, used by RevisitReplace
+	Value interface{}
+	// After is used by RevisitReschedule (UseDefaultValue or 0 means
+	// RevisitDefaultDuration), and by RevisitReplace to schedule a revisit for
+	// the new value if it's >0
+	After time.Duration
+}
+
+type RevisitFunc func(cache hafezieh.Cache, key string, item *InMemItem) RevisitDecision
+
+// ExpireRevisitFunc deletes the item on its revisit
+func ExpireRevisitFunc(cache hafezieh.Cache, key string, item *InMemItem) RevisitDecision {
+	return RevisitDecision{Action: RevisitDelete}
 }
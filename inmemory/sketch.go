@@ -0,0 +1,75 @@
+package inmemory
+
+import "hash/fnv"
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+// countMinSketch estimates the access frequency of the keys with 4 bit
+// counters, which are halved periodically so the old accesses fade away.
+// It's not safe for concurrent use.
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		resetAt: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) hash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	return h1, h1>>32 | h1<<32 | 1
+}
+
+func (s *countMinSketch) increment(key string) {
+	h1, h2 := s.hash(key)
+	for i := range s.rows {
+		index := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][index] < sketchMaxCounter {
+			s.rows[i][index]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	h1, h2 := s.hash(key)
+	min := uint8(sketchMaxCounter)
+	for i := range s.rows {
+		if v := s.rows[i][(h1+uint64(i)*h2)&s.mask]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// reset halves all the counters
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,64 @@
+package inmemory
+
+import "sync/atomic"
+
+// InMemoryCacheStats is a snapshot of the counters of an InMemoryCache
+type InMemoryCacheStats struct {
+	// Items is the number of the items, except the negative ones
+	Items  int
+	Hits   uint64
+	Misses uint64
+
+	NegativeItems int
+	// NegativeHits is the number of the Gets which returned a negative item
+	NegativeHits uint64
+
+	// RejectedAdmissions is the number of the new keys which are not stored,
+	// because of the AdmissionFilter
+	RejectedAdmissions uint64
+
+	// ScheduledRevisits is the number of the revisits in the queue, which
+	// may include the ones of the reset or deleted items
+	ScheduledRevisits int
+}
+
+// cacheCounters are updated atomically, so it should be the first field of
+// InMemoryCache to be 64-bit aligned
+type cacheCounters struct {
+	hits               uint64
+	misses             uint64
+	negativeHits       uint64
+	rejectedAdmissions uint64
+}
+
+func (c *InMemoryCache) Stats() InMemoryCacheStats {
+	c.mutex.RLock()
+	items, negativeItems := len(c.items), len(c.negatives)
+	var scheduledRevisits int
+	if c.revisitTimeQMan != nil {
+		scheduledRevisits = len(c.revisitTimeQMan.revisitTimeQ)
+	}
+	c.mutex.RUnlock()
+	return InMemoryCacheStats{
+		Items:              items - negativeItems,
+		Hits:               atomic.LoadUint64(&c.counters.hits),
+		Misses:             atomic.LoadUint64(&c.counters.misses),
+		NegativeItems:      negativeItems,
+		NegativeHits:       atomic.LoadUint64(&c.counters.negativeHits),
+		RejectedAdmissions: atomic.LoadUint64(&c.counters.rejectedAdmissions),
+		ScheduledRevisits:  scheduledRevisits,
+	}
+}
+
+// admit checks the AdmissionFilter, if the key is new. c.mutex should be
+// locked by the caller.
+func (c *InMemoryCache) admit(key string) bool {
+	if c.config.Admission == nil {
+		return true
+	}
+	if _, found := c.items[key]; found || c.config.Admission.Admit(key) {
+		return true
+	}
+	atomic.AddUint64(&c.counters.rejectedAdmissions, 1)
+	return false
+}
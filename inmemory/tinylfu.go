@@ -0,0 +1,165 @@
+package inmemory
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	tinyLFUWindow = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+type tinyLFUEntry struct {
+	key     string
+	segment int
+}
+
+// tinyLFUPolicy is the W-TinyLFU policy. New keys enter a small LRU window
+// (1% of the capacity), and the keys leaving the window are admitted to the
+// main segmented LRU only if the frequency sketch estimates them more
+// frequent than the victim of the main part. In the main part, the keys hit
+// in probation are promoted to protected (80% of the main part).
+type tinyLFUPolicy struct {
+	mutex        sync.Mutex
+	sketch       *countMinSketch
+	windowCap    int
+	mainCap      int
+	protectedCap int
+	segments     [3]*list.List
+	entries      map[string]*list.Element
+}
+
+// NewWTinyLFUPolicy returns a W-TinyLFU policy for a cache of capacity items
+func NewWTinyLFUPolicy(capacity int) EvictionPolicy {
+	windowCap := capacity / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	mainCap := capacity - windowCap
+	t := &tinyLFUPolicy{
+		sketch:       newCountMinSketch(capacity),
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: mainCap * 8 / 10,
+		entries:      make(map[string]*list.Element),
+	}
+	for i := range t.segments {
+		t.segments[i] = list.New()
+	}
+	return t
+}
+
+func (t *tinyLFUPolicy) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.entries = make(map[string]*list.Element)
+	for i := range t.segments {
+		t.segments[i].Init()
+	}
+}
+
+func (t *tinyLFUPolicy) moveTo(element *list.Element, segment int) {
+	entry := element.Value.(*tinyLFUEntry)
+	t.segments[entry.segment].Remove(element)
+	entry.segment = segment
+	t.entries[entry.key] = t.segments[segment].PushFront(entry)
+}
+
+func (t *tinyLFUPolicy) mainLen() int {
+	return t.segments[tinyLFUProbation].Len() + t.segments[tinyLFUProtected].Len()
+}
+
+// access updates the position of a resident key, after a hit
+func (t *tinyLFUPolicy) access(element *list.Element) {
+	switch element.Value.(*tinyLFUEntry).segment {
+	case tinyLFUWindow:
+		t.segments[tinyLFUWindow].MoveToFront(element)
+	case tinyLFUProbation:
+		t.moveTo(element, tinyLFUProtected)
+		protected := t.segments[tinyLFUProtected]
+		if protected.Len() > t.protectedCap {
+			t.moveTo(protected.Back(), tinyLFUProbation)
+		}
+	case tinyLFUProtected:
+		t.segments[tinyLFUProtected].MoveToFront(element)
+	}
+}
+
+// fillMain moves the overflow of the window to probation, while the main
+// part has room
+func (t *tinyLFUPolicy) fillMain() {
+	window := t.segments[tinyLFUWindow]
+	for window.Len() > t.windowCap && t.mainLen() < t.mainCap {
+		t.moveTo(window.Back(), tinyLFUProbation)
+	}
+}
+
+func (t *tinyLFUPolicy) OnSet(key string, item *InMemItem) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sketch.increment(key)
+	if element, found := t.entries[key]; found {
+		t.access(element)
+		return
+	}
+	t.entries[key] = t.segments[tinyLFUWindow].PushFront(&tinyLFUEntry{key, tinyLFUWindow})
+	t.fillMain()
+}
+
+func (t *tinyLFUPolicy) OnGet(key string, item *InMemItem) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sketch.increment(key)
+	if element, found := t.entries[key]; found {
+		t.access(element)
+	}
+}
+
+func (t *tinyLFUPolicy) OnDel(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if element, found := t.entries[key]; found {
+		t.segments[element.Value.(*tinyLFUEntry).segment].Remove(element)
+		delete(t.entries, key)
+	}
+}
+
+// mainVictim returns the least recently used element of the main part
+func (t *tinyLFUPolicy) mainVictim() *list.Element {
+	if victim := t.segments[tinyLFUProbation].Back(); victim != nil {
+		return victim
+	}
+	return t.segments[tinyLFUProtected].Back()
+}
+
+func (t *tinyLFUPolicy) Victims(n int) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.fillMain()
+	keys := make([]string, 0, n)
+	window := t.segments[tinyLFUWindow]
+	for len(keys) < n && len(t.entries) > 0 {
+		var evicted *list.Element
+		victim := t.mainVictim()
+		if candidate := window.Back(); candidate != nil && (window.Len() > t.windowCap || victim == nil) {
+			// Admission: the more frequent one of the candidate and the
+			// victim remains
+			candidateKey := candidate.Value.(*tinyLFUEntry).key
+			if victim != nil && t.sketch.estimate(candidateKey) > t.sketch.estimate(victim.Value.(*tinyLFUEntry).key) {
+				evicted = victim
+				t.moveTo(candidate, tinyLFUProbation)
+			} else {
+				evicted = candidate
+			}
+		} else {
+			evicted = victim
+		}
+		entry := evicted.Value.(*tinyLFUEntry)
+		t.segments[entry.segment].Remove(evicted)
+		delete(t.entries, entry.key)
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
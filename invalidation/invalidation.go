@@ -0,0 +1,179 @@
+// Package invalidation keeps the local caches of the replicas coherent. The
+// changes of a wrapped cache are published to the other nodes by a
+// Transport, and the nodes delete their stale copies.
+package invalidation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// Message is an invalidation published by a node
+type Message struct {
+	// Origin is the id of the publishing node
+	Origin string `json:"origin"`
+	// Keys should be deleted
+	Keys []string `json:"keys,omitempty"`
+	// Prefixes are the prefixes of the keys which should be deleted
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Flush means all the keys should be deleted
+	Flush bool `json:"flush,omitempty"`
+}
+
+// Transport delivers the messages between the nodes
+type Transport interface {
+	// Publish sends msg to the other nodes
+	Publish(msg *Message) error
+	// Listen sets the handler of the messages of the other nodes. It's called
+	// once, before the first Publish.
+	Listen(handler func(*Message))
+	// Close stops the transport
+	Close() error
+}
+
+// Option configures the Cache returned by New
+type Option func(*Cache)
+
+// WithLogger sets the logger of the failed publishes, which are discarded by
+// default
+func WithLogger(logger hafezieh.Logger) Option {
+	return func(c *Cache) {
+		c.logger = hafezieh.LoggerWith(logger)
+	}
+}
+
+// WithNodeID sets the id of the node, which is random by default
+func WithNodeID(id string) Option {
+	return func(c *Cache) {
+		c.id = id
+	}
+}
+
+// Cache wraps a local cache. Set, Del, DelPrefix and Flush publish the
+// invalidation of the changed keys, and the invalidations of the other nodes
+// are applied to the local cache. A failed publish doesn't fail the call, as
+// the local change is already made, and it's only logged.
+type Cache struct {
+	cache     hafezieh.Cache
+	transport Transport
+	id        string
+	logger    hafezieh.Logger
+}
+
+// New wraps cache, and starts listening to the transport. Closing the
+// returned cache closes both of them.
+func New(cache hafezieh.Cache, transport Transport, options ...Option) *Cache {
+	c := &Cache{
+		cache:     cache,
+		transport: transport,
+		id:        randomID(),
+		logger:    hafezieh.NopLogger,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	transport.Listen(c.apply)
+	return c
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Unwrap returns the local cache
+func (c *Cache) Unwrap() hafezieh.Cache {
+	return c.cache
+}
+
+func (c *Cache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	if err := c.cache.Set(key, x, revisitDuration); err != nil {
+		return err
+	}
+	c.publish(&Message{Keys: []string{key}})
+	return nil
+}
+
+func (c *Cache) Get(key string) (interface{}, error) {
+	return c.cache.Get(key)
+}
+
+func (c *Cache) Del(key string) error {
+	if err := c.cache.Del(key); err != nil {
+		return err
+	}
+	c.publish(&Message{Keys: []string{key}})
+	return nil
+}
+
+// DelPrefix returns hafezieh.ErrNotSupported if the local cache isn't a
+// hafezieh.PrefixDeleter
+func (c *Cache) DelPrefix(prefix string) (int, error) {
+	deleter, ok := c.cache.(hafezieh.PrefixDeleter)
+	if !ok {
+		return 0, hafezieh.ErrNotSupported
+	}
+	n, err := deleter.DelPrefix(prefix)
+	if err != nil {
+		return n, err
+	}
+	c.publish(&Message{Prefixes: []string{prefix}})
+	return n, nil
+}
+
+// Flush returns hafezieh.ErrNotSupported if the local cache isn't a
+// hafezieh.Flusher
+func (c *Cache) Flush() error {
+	flusher, ok := c.cache.(hafezieh.Flusher)
+	if !ok {
+		return hafezieh.ErrNotSupported
+	}
+	if err := flusher.Flush(); err != nil {
+		return err
+	}
+	c.publish(&Message{Flush: true})
+	return nil
+}
+
+func (c *Cache) Close() error {
+	err := c.transport.Close()
+	if cErr := c.cache.Close(); cErr != nil {
+		err = cErr
+	}
+	return err
+}
+
+func (c *Cache) publish(msg *Message) {
+	msg.Origin = c.id
+	if err := c.transport.Publish(msg); err != nil {
+		c.logger.Warn("publishing invalidation failed", "keys", msg.Keys, "prefixes", msg.Prefixes,
+			"flush", msg.Flush, "error", err)
+	}
+}
+
+// apply deletes the keys of a message of another node from the local cache
+func (c *Cache) apply(msg *Message) {
+	if msg.Origin == c.id {
+		return
+	}
+	if msg.Flush {
+		if flusher, ok := c.cache.(hafezieh.Flusher); ok {
+			flusher.Flush()
+		}
+		return
+	}
+	for _, key := range msg.Keys {
+		c.cache.Del(key)
+	}
+	if len(msg.Prefixes) > 0 {
+		if deleter, ok := c.cache.(hafezieh.PrefixDeleter); ok {
+			for _, prefix := range msg.Prefixes {
+				deleter.DelPrefix(prefix)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package invalidation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+func newLocalCache(t *testing.T) hafezieh.Cache {
+	cache, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+// waitFor polls cond, as the messages may be delivered asynchronously
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testInvalidation(t *testing.T, a, b *Cache) {
+	missed := func(c *Cache, key string) func() bool {
+		return func() bool {
+			_, err := c.Unwrap().Get(key)
+			return err == hafezieh.ErrMiss
+		}
+	}
+
+	b.Unwrap().Set("user:1", "stale", 0)
+	a.Set("user:1", "fresh", 0)
+	waitFor(t, "Set invalidation", missed(b, "user:1"))
+	if x, err := a.Get("user:1"); err != nil || x != "fresh" {
+		t.Fatal("the origin applied its own invalidation:", x, err)
+	}
+
+	b.Unwrap().Set("user:1", "copy", 0)
+	a.Del("user:1")
+	waitFor(t, "Del invalidation", missed(b, "user:1"))
+
+	b.Unwrap().Set("user:2", 2, 0)
+	b.Unwrap().Set("post:1", 1, 0)
+	if _, err := a.DelPrefix("user:"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "DelPrefix invalidation", missed(b, "user:2"))
+	if _, err := b.Get("post:1"); err != nil {
+		t.Fatal("unexpected invalidation:", err)
+	}
+
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "Flush invalidation", missed(b, "post:1"))
+}
+
+func TestLoopback(t *testing.T) {
+	hub := NewLoopbackHub()
+	a := New(newLocalCache(t), hub.Transport())
+	b := New(newLocalCache(t), hub.Transport())
+	defer a.Close()
+	defer b.Close()
+	testInvalidation(t, a, b)
+}
+
+func TestTCP(t *testing.T) {
+	ta, err := ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb, err := ListenTCP("127.0.0.1:0", ta.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ta.AddPeer(tb.Addr().String())
+	a := New(newLocalCache(t), ta)
+	b := New(newLocalCache(t), tb)
+	testInvalidation(t, a, b)
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The broken connection is noticed by the next writes
+	waitFor(t, "the error of the closed peer", func() bool {
+		return ta.Publish(&Message{Keys: []string{"x"}}) != nil
+	})
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTCPUnreachablePeer(t *testing.T) {
+	dead, err := ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+
+	tb, err := ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ta, err := ListenTCP("127.0.0.1:0", deadAddr, tb.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(newLocalCache(t), ta)
+	b := New(newLocalCache(t), tb)
+	defer a.Close()
+	defer b.Close()
+
+	b.Unwrap().Set("user:1", "stale", 0)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		a.Del("user:1")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatal("the writes waited for the unreachable peer:", elapsed)
+	}
+	waitFor(t, "Del invalidation", func() bool {
+		_, err := b.Unwrap().Get("user:1")
+		return err == hafezieh.ErrMiss
+	})
+	waitFor(t, "the error of the unreachable peer", func() bool {
+		return ta.Publish(&Message{Keys: []string{"x"}}) != nil
+	})
+}
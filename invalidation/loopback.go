@@ -0,0 +1,60 @@
+package invalidation
+
+import (
+	"sync"
+)
+
+// LoopbackHub connects its transports in-process, e.g. for the tests or the
+// caches of a single process
+type LoopbackHub struct {
+	mutex      sync.RWMutex
+	transports map[*loopbackTransport]struct{}
+}
+
+// NewLoopbackHub returns an empty hub
+func NewLoopbackHub() *LoopbackHub {
+	return &LoopbackHub{transports: make(map[*loopbackTransport]struct{})}
+}
+
+type loopbackTransport struct {
+	hub     *LoopbackHub
+	handler func(*Message)
+}
+
+// Transport returns a new transport connected to the hub. The messages are
+// delivered to the other transports synchronously.
+func (h *LoopbackHub) Transport() Transport {
+	t := &loopbackTransport{hub: h}
+	h.mutex.Lock()
+	h.transports[t] = struct{}{}
+	h.mutex.Unlock()
+	return t
+}
+
+func (t *loopbackTransport) Publish(msg *Message) error {
+	t.hub.mutex.RLock()
+	handlers := make([]func(*Message), 0, len(t.hub.transports))
+	for other := range t.hub.transports {
+		if other != t && other.handler != nil {
+			handlers = append(handlers, other.handler)
+		}
+	}
+	t.hub.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (t *loopbackTransport) Listen(handler func(*Message)) {
+	t.hub.mutex.Lock()
+	t.handler = handler
+	t.hub.mutex.Unlock()
+}
+
+func (t *loopbackTransport) Close() error {
+	t.hub.mutex.Lock()
+	delete(t.hub.transports, t)
+	t.hub.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,228 @@
+package invalidation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// peerQueueSize is the number of the messages which can wait for a peer,
+// after which the new ones are dropped
+const peerQueueSize = 1024
+
+// TCPTransport sends the messages to its peers over TCP, as JSON values.
+// Each node listens on an address, and dials the addresses of the others.
+// Each peer has its own queue and sender, so Publish doesn't wait for the
+// network, and a slow or unreachable peer doesn't delay the others. The
+// connections are kept, and redialed after a failure. As a broken connection
+// may be noticed after a few writes, and the messages are dropped while the
+// queue of a peer is full, some messages may be lost.
+type TCPTransport struct {
+	listener net.Listener
+	timeout  time.Duration
+	stop     chan struct{}
+
+	mutex    sync.Mutex
+	peers    map[string]*tcpPeer
+	accepted map[net.Conn]struct{}
+	handler  func(*Message)
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// tcpPeer is the queue and the connection of a peer
+type tcpPeer struct {
+	addr  string
+	queue chan []byte
+
+	// mutex guards err. conn is only used by the sender.
+	mutex sync.Mutex
+	err   error
+	conn  net.Conn
+}
+
+// ListenTCP listens on addr (like "127.0.0.1:0"), and publishes to peers,
+// which can be added later by AddPeer
+func ListenTCP(addr string, peers ...string) (*TCPTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &TCPTransport{
+		listener: listener,
+		timeout:  time.Second,
+		stop:     make(chan struct{}),
+		peers:    make(map[string]*tcpPeer),
+		accepted: make(map[net.Conn]struct{}),
+	}
+	for _, peer := range peers {
+		t.AddPeer(peer)
+	}
+	t.wg.Add(1)
+	go t.acceptLoop()
+	return t, nil
+}
+
+// Addr returns the address of the listener
+func (t *TCPTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// AddPeer adds the address of another node
+func (t *TCPTransport) AddPeer(addr string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, found := t.peers[addr]; found || t.closed {
+		return
+	}
+	p := &tcpPeer{addr: addr, queue: make(chan []byte, peerQueueSize)}
+	t.peers[addr] = p
+	t.wg.Add(1)
+	go t.sendLoop(p)
+}
+
+// Publish queues msg for all the peers, without waiting for them to be
+// sent. It returns the errors of the peers whose queue is full, or whose
+// last send has failed.
+func (t *TCPTransport) Publish(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return fmt.Errorf("invalidation: transport is closed")
+	}
+	var failed []string
+	for addr, p := range t.peers {
+		select {
+		case p.queue <- data:
+		default:
+			failed = append(failed, addr+": queue is full")
+			continue
+		}
+		p.mutex.Lock()
+		err := p.err
+		p.mutex.Unlock()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", addr, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("invalidation: publishing to %d peers failed: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// sendLoop sends the queued messages of the peer, until Close
+func (t *TCPTransport) sendLoop(p *tcpPeer) {
+	defer t.wg.Done()
+	defer func() {
+		if p.conn != nil {
+			p.conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case data := <-p.queue:
+			err := t.send(p, data)
+			p.mutex.Lock()
+			p.err = err
+			p.mutex.Unlock()
+		}
+	}
+}
+
+// send writes data to the peer, and redials once if the kept connection is
+// broken. It's only called by the sender of the peer.
+func (t *TCPTransport) send(p *tcpPeer, data []byte) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if p.conn == nil {
+			p.conn, err = net.DialTimeout("tcp", p.addr, t.timeout)
+			if err != nil {
+				return err
+			}
+		}
+		p.conn.SetWriteDeadline(time.Now().Add(t.timeout))
+		if _, err = p.conn.Write(data); err == nil {
+			return nil
+		}
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+func (t *TCPTransport) Listen(handler func(*Message)) {
+	t.mutex.Lock()
+	t.handler = handler
+	t.mutex.Unlock()
+}
+
+func (t *TCPTransport) acceptLoop() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.mutex.Lock()
+		if t.closed {
+			t.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		t.accepted[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mutex.Unlock()
+		go t.readLoop(conn)
+	}
+}
+
+func (t *TCPTransport) readLoop(conn net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		t.mutex.Lock()
+		delete(t.accepted, conn)
+		t.mutex.Unlock()
+		conn.Close()
+	}()
+	decoder := json.NewDecoder(conn)
+	for {
+		msg := &Message{}
+		if err := decoder.Decode(msg); err != nil {
+			return
+		}
+		t.mutex.Lock()
+		handler := t.handler
+		t.mutex.Unlock()
+		if handler != nil {
+			handler(msg)
+		}
+	}
+}
+
+// Close closes the listener and all the connections, and drops the queued
+// messages
+func (t *TCPTransport) Close() error {
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.stop)
+	err := t.listener.Close()
+	for conn := range t.accepted {
+		conn.Close()
+	}
+	t.mutex.Unlock()
+	t.wg.Wait()
+	return err
+}
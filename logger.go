@@ -0,0 +1,109 @@
+package hafezieh
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// Logger receives the structured logs of the engines. keyvals are
+// alternating keys and values, like log/slog, so a *slog.Logger can be used
+// directly.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+
+// NopLogger discards all the logs. It's the default Logger of the engines.
+var NopLogger Logger = nopLogger{}
+
+type fieldsLogger struct {
+	logger Logger
+	fields []interface{}
+}
+
+func (l *fieldsLogger) with(keyvals []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(l.fields)+len(keyvals)), l.fields...), keyvals...)
+}
+
+func (l *fieldsLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debug(msg, l.with(keyvals)...)
+}
+
+func (l *fieldsLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Info(msg, l.with(keyvals)...)
+}
+
+func (l *fieldsLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Warn(msg, l.with(keyvals)...)
+}
+
+func (l *fieldsLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Error(msg, l.with(keyvals)...)
+}
+
+// LoggerWith returns a Logger which adds keyvals to the logs, before their
+// own fields. A nil logger means NopLogger.
+func LoggerWith(logger Logger, keyvals ...interface{}) Logger {
+	if _, nop := logger.(nopLogger); nop || logger == nil {
+		return NopLogger
+	}
+	if len(keyvals) == 0 {
+		return logger
+	}
+	return &fieldsLogger{logger: logger, fields: keyvals}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+	debug  bool
+}
+
+func (l *stdLogger) output(level, msg string, keyvals []interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(level)
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fmt.Fprintf(&buf, " %v=%v", keyvals[i], value)
+	}
+	l.logger.Output(3, buf.String())
+}
+
+func (l *stdLogger) Debug(msg string, keyvals ...interface{}) {
+	if l.debug {
+		l.output("DEBUG", msg, keyvals)
+	}
+}
+
+func (l *stdLogger) Info(msg string, keyvals ...interface{}) {
+	l.output("INFO", msg, keyvals)
+}
+
+func (l *stdLogger) Warn(msg string, keyvals ...interface{}) {
+	l.output("WARN", msg, keyvals)
+}
+
+func (l *stdLogger) Error(msg string, keyvals ...interface{}) {
+	l.output("ERROR", msg, keyvals)
+}
+
+// NewStdLogger returns a Logger which writes the logs, like
+// "WARN msg key=value", to logger. The debug logs are dropped unless debug
+// is set.
+func NewStdLogger(logger *log.Logger, debug bool) Logger {
+	return &stdLogger{logger: logger, debug: debug}
+}
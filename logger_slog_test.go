@@ -0,0 +1,20 @@
+//go:build go1.21
+// +build go1.21
+
+package hafezieh
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	var logger Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	LoggerWith(logger, "cache", "users").Warn("cleanup", "evicted", 10)
+	if !strings.Contains(buf.String(), "level=WARN msg=cleanup cache=users evicted=10") {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+}
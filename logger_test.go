@@ -0,0 +1,21 @@
+package hafezieh
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := LoggerWith(NewStdLogger(log.New(&buf, "", 0), false), "cache", "users")
+	logger.Debug("dropped")
+	logger.Warn("cleanup", "evicted", 10, "odd")
+	if buf.String() != "WARN cleanup cache=users evicted=10 odd=MISSING\n" {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+
+	if LoggerWith(nil, "cache", "users") != NopLogger {
+		t.Fatal("expecting NopLogger for nil")
+	}
+}
@@ -0,0 +1,50 @@
+// Package logrusadapter routes the logs of the cache engines to logrus
+package logrusadapter
+
+import (
+	"fmt"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/sirupsen/logrus"
+)
+
+type logger struct {
+	entry *logrus.Entry
+}
+
+// New returns a hafezieh.Logger which writes to l. The keys of the logs
+// became the fields of the logrus entries.
+func New(l logrus.FieldLogger) hafezieh.Logger {
+	return &logger{entry: l.WithFields(logrus.Fields{})}
+}
+
+func (l *logger) withFields(keyvals []interface{}) *logrus.Entry {
+	if len(keyvals) == 0 {
+		return l.entry
+	}
+	fields := make(logrus.Fields, len(keyvals)/2+1)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields[fmt.Sprint(keyvals[i])] = value
+	}
+	return l.entry.WithFields(fields)
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) {
+	l.withFields(keyvals).Debug(msg)
+}
+
+func (l *logger) Info(msg string, keyvals ...interface{}) {
+	l.withFields(keyvals).Info(msg)
+}
+
+func (l *logger) Warn(msg string, keyvals ...interface{}) {
+	l.withFields(keyvals).Warn(msg)
+}
+
+func (l *logger) Error(msg string, keyvals ...interface{}) {
+	l.withFields(keyvals).Error(msg)
+}
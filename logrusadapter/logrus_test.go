@@ -0,0 +1,20 @@
+package logrusadapter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.Out = &buf
+	l.Formatter = &logrus.TextFormatter{DisableTimestamp: true}
+	New(l).Warn("cleanup", "cache", "users", "evicted", 10)
+	if !strings.Contains(buf.String(), `level=warning msg=cleanup cache=users evicted=10`) {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+}
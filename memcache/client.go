@@ -0,0 +1,538 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/config"
+)
+
+var (
+	// ErrNoAddr is returned by NewClient, when ClientConfig.Addr is not set
+	ErrNoAddr = errors.New("No Addr is set")
+	// ErrInvalidKey is returned for the keys longer than 250 bytes, or with
+	// spaces or control characters
+	ErrInvalidKey = errors.New("Invalid key for memcache")
+)
+
+// The flags of the items, which tell how the value is encoded
+const (
+	flagBytes  = 0
+	flagString = 1
+	flagCodec  = 2
+)
+
+func init() {
+	hafezieh.Register("memcache", OpenURL)
+}
+
+// ClientConfig of a Client
+type ClientConfig struct {
+	// Addr of the server, like "127.0.0.1:11211"
+	Addr string `mapstructure:"addr"`
+	// MaxIdleConns is the number of the connections kept for reuse.
+	// Default: 2
+	MaxIdleConns int `mapstructure:"max-idle-conns"`
+	// Timeout of dialing and each call. Default: 1 second
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Codec of the values other than []byte and string.
+	// Default: hafezieh.GobCodec
+	Codec hafezieh.Codec
+}
+
+func (config *ClientConfig) validateAndSetDefaults() error {
+	var errs hafezieh.ValidationErrors
+	if config.Addr == "" {
+		errs = errs.Append(ErrNoAddr)
+	}
+	if config.MaxIdleConns == 0 {
+		config.MaxIdleConns = 2
+	} else if config.MaxIdleConns < 0 {
+		errs = errs.Append(errors.New("MaxIdleConns can't be negative"))
+	}
+	if config.Timeout == 0 {
+		config.Timeout = time.Second
+	} else if config.Timeout < 0 {
+		errs = errs.Append(errors.New("Timeout can't be negative"))
+	}
+	if config.Codec == nil {
+		config.Codec = hafezieh.GobCodec
+	}
+	return errs.Err()
+}
+
+// Validate checks the config, without changing it
+func (config ClientConfig) Validate() error {
+	return config.validateAndSetDefaults()
+}
+
+// Client is a cache engine, which stores the items in a memcached compatible
+// server, like hafeziehd. []byte and string values are stored as they are,
+// so they can be shared with the other clients, and the others are encoded
+// by the Codec. The revisitDuration is passed as the exptime, so the items
+// are expired, not revisited, and UseDefaultValue means no expiration.
+type Client struct {
+	config ClientConfig
+
+	mutex  sync.Mutex
+	idle   []*clientConn
+	closed bool
+}
+
+type clientConn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+// NewClient returns a Client of the server. No connection is made until the
+// first call.
+func NewClient(config ClientConfig) (*Client, error) {
+	if err := config.validateAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	return &Client{config: config}, nil
+}
+
+// OpenURL builds a Client from a URL like
+// "memcache://127.0.0.1:11211?timeout=500ms". The query parameters are the
+// mapstructure names of ClientConfig.
+func OpenURL(u *url.URL) (hafezieh.Cache, error) {
+	settings := map[string]interface{}{"addr": u.Host}
+	for key, values := range u.Query() {
+		settings[key] = values[len(values)-1]
+	}
+	c := &ClientConfig{}
+	if err := config.Decode(settings, c); err != nil {
+		return nil, err
+	}
+	return NewClient(*c)
+}
+
+func (c *Client) conn() (*clientConn, error) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, hafezieh.ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mutex.Unlock()
+		return cn, nil
+	}
+	c.mutex.Unlock()
+
+	nc, err := net.DialTimeout("tcp", c.config.Addr, c.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &clientConn{
+		nc: nc,
+		rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+	}, nil
+}
+
+// release keeps cn for reuse, or closes it if the call has failed
+func (c *Client) release(cn *clientConn, err error) {
+	if err != nil && !isResponseError(err) {
+		cn.nc.Close()
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed || len(c.idle) >= c.config.MaxIdleConns {
+		cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// responseError is an error reply of the server, after which the connection
+// is still usable
+type responseError string
+
+func (e responseError) Error() string {
+	return "memcache: " + string(e)
+}
+
+func isResponseError(err error) bool {
+	switch err {
+	case hafezieh.ErrMiss, hafezieh.ErrExists, hafezieh.ErrCASConflict,
+		hafezieh.ErrNotSupported, hafezieh.ErrNotNumeric:
+		return true
+	}
+	_, ok := err.(responseError)
+	return ok
+}
+
+// call sends a request and reads its reply by fn, on a pooled connection
+func (c *Client) call(fn func(rw *bufio.ReadWriter) error) error {
+	cn, err := c.conn()
+	if err != nil {
+		return err
+	}
+	cn.nc.SetDeadline(time.Now().Add(c.config.Timeout))
+	err = fn(cn.rw)
+	c.release(cn, err)
+	return err
+}
+
+// readReply reads a single line reply, and converts the error replies
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case line == "ERROR":
+		return "", responseError("unknown command")
+	case strings.HasPrefix(line, "SERVER_ERROR not supported"):
+		return "", hafezieh.ErrNotSupported
+	case strings.HasPrefix(line, "SERVER_ERROR "), strings.HasPrefix(line, "CLIENT_ERROR "):
+		return "", responseError(line)
+	}
+	return line, nil
+}
+
+// exptime converts revisitDuration to the exptime of the protocol
+func exptime(revisitDuration time.Duration) (int64, error) {
+	if revisitDuration == hafezieh.UseDefaultValue {
+		return 0, nil
+	}
+	if revisitDuration < 0 {
+		return 0, hafezieh.ErrNegativeDuration
+	}
+	seconds := int64((revisitDuration + time.Second - 1) / time.Second)
+	if seconds > relativeExpirationLimit {
+		return time.Now().Unix() + seconds, nil
+	}
+	return seconds, nil
+}
+
+func (c *Client) encode(x interface{}) (uint32, []byte, error) {
+	switch v := x.(type) {
+	case []byte:
+		return flagBytes, v, nil
+	case string:
+		return flagString, []byte(v), nil
+	}
+	data, err := c.config.Codec.Encode(x)
+	return flagCodec, data, err
+}
+
+func (c *Client) decode(flags uint32, data []byte) (interface{}, error) {
+	switch flags {
+	case flagBytes:
+		return data, nil
+	case flagString:
+		return string(data), nil
+	case flagCodec:
+		return c.config.Codec.Decode(data)
+	}
+	return nil, fmt.Errorf("memcache: unknown flags %d", flags)
+}
+
+func (c *Client) store(command, key string, x interface{}, cas uint64, revisitDuration time.Duration) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	exp, err := exptime(revisitDuration)
+	if err != nil {
+		return err
+	}
+	flags, data, err := c.encode(x)
+	if err != nil {
+		return err
+	}
+	return c.call(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "%s %s %d %d %d", command, key, flags, exp, len(data))
+		if command == "cas" {
+			fmt.Fprintf(rw, " %d", cas)
+		}
+		rw.WriteString("\r\n")
+		rw.Write(data)
+		rw.WriteString("\r\n")
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		reply, err := readReply(rw.Reader)
+		if err != nil {
+			return err
+		}
+		switch reply {
+		case "STORED":
+			return nil
+		case "NOT_STORED":
+			if command == "add" {
+				return hafezieh.ErrExists
+			}
+			return hafezieh.ErrMiss
+		case "EXISTS", "NOT_FOUND":
+			return hafezieh.ErrCASConflict
+		}
+		return responseError("unexpected reply: " + reply)
+	})
+}
+
+func (c *Client) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.store("set", key, x, 0, revisitDuration)
+}
+
+func (c *Client) Add(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.store("add", key, x, 0, revisitDuration)
+}
+
+func (c *Client) Replace(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.store("replace", key, x, 0, revisitDuration)
+}
+
+func (c *Client) CompareAndSwap(key string, x interface{}, cas uint64, revisitDuration time.Duration) error {
+	return c.store("cas", key, x, cas, revisitDuration)
+}
+
+func (c *Client) Get(key string) (interface{}, error) {
+	x, _, err := c.retrieve("get", key)
+	return x, err
+}
+
+func (c *Client) Gets(key string) (interface{}, uint64, error) {
+	return c.retrieve("gets", key)
+}
+
+func (c *Client) retrieve(command, key string) (x interface{}, cas uint64, err error) {
+	if !validKey(key) {
+		return nil, 0, ErrInvalidKey
+	}
+	var flags uint32
+	var data []byte
+	found := false
+	err = c.call(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "%s %s\r\n", command, key)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readReply(rw.Reader)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != "VALUE" {
+				// Not a response error, as the rest of the reply is unread
+				return errors.New("memcache: unexpected reply: " + line)
+			}
+			f, err1 := strconv.ParseUint(fields[2], 10, 32)
+			length, err2 := strconv.Atoi(fields[3])
+			if err1 != nil || err2 != nil || length < 0 {
+				return errors.New("memcache: bad VALUE line: " + line)
+			}
+			if len(fields) > 4 {
+				if cas, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+					return errors.New("memcache: bad VALUE line: " + line)
+				}
+			}
+			block := make([]byte, length+2)
+			if _, err := io.ReadFull(rw, block); err != nil {
+				return err
+			}
+			flags, data, found = uint32(f), block[:length], true
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !found {
+		return nil, 0, hafezieh.ErrMiss
+	}
+	x, err = c.decode(flags, data)
+	return x, cas, err
+}
+
+// Del deletes the key. Deleting a missing key is not an error.
+func (c *Client) Del(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	return c.call(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "delete %s\r\n", key)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		reply, err := readReply(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if reply != "DELETED" && reply != "NOT_FOUND" {
+			return responseError("unexpected reply: " + reply)
+		}
+		return nil
+	})
+}
+
+// Increment adds delta to the decimal value of the key, by the incr command,
+// wrapping around at 64 bits. Unlike hafezieh.CounterCache, the missing keys
+// are not created, and ErrMiss is returned.
+func (c *Client) Increment(key string, delta uint64) (uint64, error) {
+	return c.incr("incr", key, delta)
+}
+
+// Decrement subtracts delta from the decimal value of the key, by the decr
+// command. The values don't go below 0, and the missing keys are not
+// created.
+func (c *Client) Decrement(key string, delta uint64) (uint64, error) {
+	return c.incr("decr", key, delta)
+}
+
+func (c *Client) incr(command, key string, delta uint64) (uint64, error) {
+	if !validKey(key) {
+		return 0, ErrInvalidKey
+	}
+	var value uint64
+	err := c.call(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "%s %s %d\r\n", command, key, delta)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		reply, err := readReply(rw.Reader)
+		if err != nil {
+			if strings.Contains(err.Error(), "non-numeric") {
+				return hafezieh.ErrNotNumeric
+			}
+			return err
+		}
+		if reply == "NOT_FOUND" {
+			return hafezieh.ErrMiss
+		}
+		value, err = strconv.ParseUint(reply, 10, 64)
+		if err != nil {
+			return responseError("unexpected reply: " + reply)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Flush deletes all the keys of the server
+func (c *Client) Flush() error {
+	return c.call(func(rw *bufio.ReadWriter) error {
+		rw.WriteString("flush_all\r\n")
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		reply, err := readReply(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if reply != "OK" {
+			return responseError("unexpected reply: " + reply)
+		}
+		return nil
+	})
+}
+
+// Keys lists the keys with the prefix, by the keys extension of hafeziehd
+func (c *Client) Keys(prefix string) ([]string, error) {
+	if prefix != "" && !validKey(prefix) {
+		return nil, ErrInvalidKey
+	}
+	var keys []string
+	err := c.call(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "keys %s\r\n", prefix)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readReply(rw.Reader)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			if !strings.HasPrefix(line, "KEY ") {
+				return errors.New("memcache: unexpected reply: " + line)
+			}
+			keys = append(keys, line[len("KEY "):])
+		}
+	})
+	return keys, err
+}
+
+// DelPrefix deletes the keys with the prefix, by the delprefix extension of
+// hafeziehd
+func (c *Client) DelPrefix(prefix string) (int, error) {
+	if !validKey(prefix) {
+		return 0, ErrInvalidKey
+	}
+	var n int
+	err := c.call(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "delprefix %s\r\n", prefix)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		reply, err := readReply(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(reply, "DELETED ") {
+			return responseError("unexpected reply: " + reply)
+		}
+		n, err = strconv.Atoi(reply[len("DELETED "):])
+		return err
+	})
+	return n, err
+}
+
+// Stats returns the STAT lines of the server, by their names
+func (c *Client) Stats() (map[string]string, error) {
+	stats := map[string]string{}
+	err := c.call(func(rw *bufio.ReadWriter) error {
+		rw.WriteString("stats\r\n")
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readReply(rw.Reader)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			fields := strings.SplitN(line, " ", 3)
+			if len(fields) != 3 || fields[0] != "STAT" {
+				return errors.New("memcache: unexpected reply: " + line)
+			}
+			stats[fields[1]] = fields[2]
+		}
+	})
+	return stats, err
+}
+
+// Close closes the idle connections, and the later calls return ErrClosed
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
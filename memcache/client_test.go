@@ -0,0 +1,200 @@
+package memcache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+type point struct {
+	X, Y int
+}
+
+func init() {
+	gob.Register(point{})
+}
+
+func TestClient(t *testing.T) {
+	_, cache, addr, stop := startServer(t)
+	defer stop()
+
+	c, err := hafezieh.Open("memcache://" + addr + "?max-idle-conns=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	client := c.(*Client)
+
+	values := map[string]interface{}{
+		"bytes":  []byte("raw"),
+		"string": "text",
+		"struct": point{1, 2},
+	}
+	for key, value := range values {
+		if err := client.Set(key, value, time.Minute); err != nil {
+			t.Fatal(key, err)
+		}
+	}
+	if x, err := client.Get("bytes"); err != nil || string(x.([]byte)) != "raw" {
+		t.Fatal("unexpected bytes:", x, err)
+	}
+	if x, err := client.Get("string"); err != nil || x != "text" {
+		t.Fatal("unexpected string:", x, err)
+	}
+	if x, err := client.Get("struct"); err != nil || x != (point{1, 2}) {
+		t.Fatal("unexpected struct:", x, err)
+	}
+	if item, _ := cache.Inspect("string"); item.Item.(Item).Flags != flagString {
+		t.Fatal("unexpected item on the server:", item.Item)
+	}
+	if _, err := client.Get("missing"); err != hafezieh.ErrMiss {
+		t.Fatal("expected ErrMiss, got", err)
+	}
+	if err := client.Set("has space", "x", 0); err != ErrInvalidKey {
+		t.Fatal("expected ErrInvalidKey, got", err)
+	}
+
+	if err := client.Add("string", "x", 0); err != hafezieh.ErrExists {
+		t.Fatal("expected ErrExists, got", err)
+	}
+	if err := client.Replace("missing", "x", 0); err != hafezieh.ErrMiss {
+		t.Fatal("expected ErrMiss, got", err)
+	}
+	_, cas, err := client.Gets("string")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CompareAndSwap("string", "new", cas+1, 0); err != hafezieh.ErrCASConflict {
+		t.Fatal("expected ErrCASConflict, got", err)
+	}
+	if err := client.CompareAndSwap("string", "new", cas, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Set("counter", "10", 0)
+	if n, err := client.Increment("counter", 5); err != nil || n != 15 {
+		t.Fatal("unexpected Increment:", n, err)
+	}
+	if n, err := client.Decrement("counter", 20); err != nil || n != 0 {
+		t.Fatal("unexpected Decrement:", n, err)
+	}
+	if _, err := client.Increment("missing", 1); err != hafezieh.ErrMiss {
+		t.Fatal("expected ErrMiss, got", err)
+	}
+	if _, ok := c.(hafezieh.CounterCache); ok {
+		t.Fatal("expected Client not to claim CounterCache")
+	}
+	if _, err := client.Increment("string", 1); err != hafezieh.ErrNotNumeric {
+		t.Fatal("expected ErrNotNumeric, got", err)
+	}
+
+	keys, err := client.Keys("s")
+	if err != nil || len(keys) != 2 || keys[0] != "string" || keys[1] != "struct" {
+		t.Fatal("unexpected keys:", keys, err)
+	}
+	if n, err := client.DelPrefix("s"); err != nil || n != 2 {
+		t.Fatal("unexpected DelPrefix:", n, err)
+	}
+	if err := client.Del("bytes"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Del("bytes"); err != nil {
+		t.Fatal("unexpected error of a missing key:", err)
+	}
+	if stats, err := client.Stats(); err != nil || stats["curr_items"] != "1" {
+		t.Fatal("unexpected stats:", stats, err)
+	}
+	if err := client.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 0 {
+		t.Fatal("unexpected items after Flush:", cache.Len())
+	}
+
+	client.Close()
+	if _, err := client.Get("bytes"); err != hafezieh.ErrClosed {
+		t.Fatal("expected ErrClosed, got", err)
+	}
+}
+
+func TestExptime(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		want int64
+	}{
+		{hafezieh.UseDefaultValue, 0},
+		{0, 0},
+		{1500 * time.Millisecond, 2},
+		{time.Hour, 3600},
+	}
+	for _, c := range cases {
+		if got, err := exptime(c.d); err != nil || got != c.want {
+			t.Error(c.d, got, err)
+		}
+	}
+	if got, _ := exptime(60 * 24 * time.Hour); got < time.Now().Unix() {
+		t.Error("expected a unix time, got", got)
+	}
+	if _, err := exptime(-2); err != hafezieh.ErrNegativeDuration {
+		t.Error("expected ErrNegativeDuration, got", err)
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	if err := (ClientConfig{}).Validate(); err == nil {
+		t.Fatal("expected an error without Addr")
+	}
+	if _, err := NewClient(ClientConfig{Addr: "localhost:11211", MaxIdleConns: -1}); err == nil {
+		t.Fatal("expected an error of negative MaxIdleConns")
+	}
+}
+
+func TestClientBadValueLine(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var requests int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					if atomic.AddInt32(&requests, 1) == 1 {
+						fmt.Fprint(conn, "VALUE a 0\r\nx\r\nEND\r\n")
+					} else {
+						fmt.Fprint(conn, "END\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	client, err := NewClient(ClientConfig{Addr: listener.Addr().String(), MaxIdleConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Get("a"); err == nil || err == hafezieh.ErrMiss {
+		t.Fatal("expected an error of the bad VALUE line, got:", err)
+	}
+	// The connection of the unread reply is not reused
+	if _, err := client.Get("a"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting ErrMiss, got:", err)
+	}
+}
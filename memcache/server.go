@@ -0,0 +1,608 @@
+// Package memcache shares a hafezieh.Cache with the non-Go services, over the
+// memcached text protocol, and provides the client engine of it.
+//
+// Besides the standard storage, retrieval, delete, incr/decr, flush_all,
+// stats, version and quit commands, two extensions are supported:
+//
+//	keys <prefix>                 lists the keys, as "KEY <key>" lines and END
+//	delprefix <prefix> [noreply]  deletes the keys, and returns "DELETED <n>"
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+var (
+	// ErrServerClosed is returned by Serve after Shutdown
+	ErrServerClosed = errors.New("memcache: Server closed")
+
+	errClient = errors.New("bad command line format")
+)
+
+const (
+	maxKeyLength   = 250
+	maxLineLength  = 8 * 1024
+	maxValueLength = 64 * 1024 * 1024
+	// relativeExpirationLimit is the largest exptime which is relative to
+	// now, the larger ones are unix times
+	relativeExpirationLimit = 30 * 24 * 60 * 60
+)
+
+// Item is the value stored in the cache by the Server
+type Item struct {
+	Flags uint32
+	Value []byte
+	// Expires is when the item expires, zero if never
+	Expires time.Time
+}
+
+// alive tells if the item is not expired at n
+func (item Item) alive(n time.Time) bool {
+	return item.Expires.IsZero() || n.Before(item.Expires)
+}
+
+// Server serves a cache over the memcached text protocol. The expiration
+// times are kept in the items, and the expired items are not returned. They
+// are also passed as the revisitDuration (at least 5 seconds), only to clean
+// the expired items up, so an InMemoryCache should use ExpireRevisitFunc.
+type Server struct {
+	cache  hafezieh.Cache
+	logger hafezieh.Logger
+
+	mutex    sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+// NewServer returns a Server of cache. A nil logger discards the logs.
+func NewServer(cache hafezieh.Cache, logger hafezieh.Logger) *Server {
+	return &Server{
+		cache:  cache,
+		logger: hafezieh.LoggerWith(logger),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address, and calls Serve
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts the connections of listener, until Shutdown
+func (s *Server) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closing := s.closing
+			s.mutex.Unlock()
+			if closing {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mutex.Lock()
+		if s.closing {
+			s.mutex.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting the connections, lets the running commands
+// finish, and closes the connections. It returns ctx.Err() if ctx is done
+// before that.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		// Wakes up the connections waiting for the next command
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if err != io.EOF && !isTimeout(err) {
+				s.logger.Debug("memcache connection failed", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+		s.mutex.Lock()
+		closing := s.closing
+		s.mutex.Unlock()
+		if closing {
+			return
+		}
+		quit, err := s.execute(line, r, w)
+		if err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// readLine reads a line ending with "\r\n" or "\n", without it
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull || len(line) > maxLineLength {
+		return "", errors.New("line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// execute runs a command line. The returned error means the connection
+// should be closed.
+func (s *Server) execute(line string, r *bufio.Reader, w *bufio.Writer) (quit bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		w.WriteString("ERROR\r\n")
+		return false, nil
+	}
+	noreply := len(fields) > 1 && fields[len(fields)-1] == "noreply"
+	if noreply {
+		fields = fields[:len(fields)-1]
+	}
+	var reply string
+	switch command, args := fields[0], fields[1:]; command {
+	case "get", "gets":
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		s.retrieve(w, args, command == "gets")
+		return false, nil
+	case "set", "add", "replace", "cas":
+		reply, err = s.store(command, args, r)
+		if err != nil {
+			return false, err
+		}
+	case "delete":
+		reply = s.delete(args)
+	case "incr", "decr":
+		reply = s.incr(args, command == "decr")
+	case "flush_all":
+		reply = s.flush()
+	case "keys":
+		s.keys(w, args)
+		return false, nil
+	case "delprefix":
+		reply = s.delPrefix(args)
+	case "stats":
+		s.stats(w)
+		return false, nil
+	case "version":
+		reply = "VERSION hafezieh"
+	case "quit":
+		return true, nil
+	default:
+		reply = "ERROR"
+	}
+	if !noreply {
+		w.WriteString(reply)
+		w.WriteString("\r\n")
+	}
+	return false, nil
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func serverError(err error) string {
+	if err == hafezieh.ErrNotSupported {
+		return "SERVER_ERROR not supported"
+	}
+	return "SERVER_ERROR " + strings.Replace(err.Error(), "\r\n", " ", -1)
+}
+
+func (s *Server) retrieve(w *bufio.Writer, keys []string, withCAS bool) {
+	atomicCache, _ := s.cache.(hafezieh.AtomicCache)
+	for _, key := range keys {
+		var x interface{}
+		var cas uint64
+		var err error
+		if withCAS && atomicCache != nil {
+			x, cas, err = atomicCache.Gets(key)
+		} else {
+			x, err = s.cache.Get(key)
+		}
+		if err != nil {
+			continue
+		}
+		item, ok := x.(Item)
+		if !ok || !item.alive(time.Now()) {
+			// Set by the other users of the cache, or expired
+			continue
+		}
+		if withCAS {
+			fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, item.Flags, len(item.Value), cas)
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, item.Flags, len(item.Value))
+		}
+		w.Write(item.Value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// expiration converts exptime to the expiration time of the item (zero if
+// never), and the revisitDuration to clean it up. It returns false if the
+// item is already expired.
+func expiration(exptime int64, n time.Time) (time.Time, time.Duration, bool) {
+	if exptime == 0 {
+		return time.Time{}, 0, true
+	}
+	if exptime < 0 {
+		return time.Time{}, 0, false
+	}
+	expires := n.Add(time.Duration(exptime) * time.Second)
+	if exptime > relativeExpirationLimit {
+		expires = time.Unix(exptime, 0)
+	}
+	d := expires.Sub(n)
+	if d <= 0 {
+		return time.Time{}, 0, false
+	}
+	if d < inmemory.MinRevisitDuration {
+		d = inmemory.MinRevisitDuration
+	}
+	return expires, d, true
+}
+
+// ExpireRevisitFunc is the inmemory.RevisitFunc of the caches served by a
+// Server. It deletes the expired items, and reschedules the revisits which
+// are kept for the items updated by add, replace, incr and decr. An item
+// replaced over one without a revisit is not cleaned up, but it's not
+// returned after its expiration anyway.
+func ExpireRevisitFunc(cache hafezieh.Cache, key string, inMemItem *inmemory.InMemItem) inmemory.RevisitDecision {
+	item, ok := inMemItem.Item.(Item)
+	switch {
+	case !ok:
+		return inmemory.RevisitDecision{Action: inmemory.RevisitDelete}
+	case item.Expires.IsZero():
+		return inmemory.RevisitDecision{Action: inmemory.RevisitKeep}
+	case item.alive(time.Now()):
+		return inmemory.RevisitDecision{
+			Action: inmemory.RevisitReschedule,
+			After:  item.Expires.Sub(time.Now()) + time.Second,
+		}
+	}
+	return inmemory.RevisitDecision{Action: inmemory.RevisitDelete}
+}
+
+// store runs set, add, replace and cas. The returned error means the data
+// block couldn't be read.
+func (s *Server) store(command string, args []string, r *bufio.Reader) (string, error) {
+	argsNum := 4
+	if command == "cas" {
+		argsNum = 5
+	}
+	if len(args) != argsNum {
+		return "ERROR", nil
+	}
+	length, err := strconv.Atoi(args[3])
+	if err != nil || length < 0 || length > maxValueLength {
+		// The data block can't be skipped
+		return "", errClient
+	}
+	data := make([]byte, length+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	if string(data[length:]) != "\r\n" {
+		// Skips the rest of the too long data block
+		if data[len(data)-1] != '\n' {
+			if _, err := readLine(r); err != nil {
+				return "", err
+			}
+		}
+		return "CLIENT_ERROR bad data chunk", nil
+	}
+
+	key := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	if !validKey(key) || err1 != nil || err2 != nil {
+		return "CLIENT_ERROR " + errClient.Error(), nil
+	}
+	n := time.Now()
+	expires, d, alive := expiration(exptime, n)
+	item := Item{Flags: uint32(flags), Value: data[:length], Expires: expires}
+
+	switch command {
+	case "set":
+		if !alive {
+			err = s.cache.Del(key)
+		} else {
+			err = s.cache.Set(key, item, d)
+		}
+	case "add", "replace":
+		atomicCache, ok := s.cache.(hafezieh.AtomicCache)
+		if !ok {
+			return serverError(hafezieh.ErrNotSupported), nil
+		}
+		if command == "add" {
+			err = atomicCache.Add(key, item, d)
+			if err == hafezieh.ErrExists {
+				// The available item may be expired
+				err = atomicCache.Update(key, func(old interface{}) (interface{}, error) {
+					if oldItem, ok := old.(Item); ok && oldItem.alive(n) {
+						return nil, hafezieh.ErrExists
+					}
+					return item, nil
+				})
+			}
+		} else {
+			err = atomicCache.Update(key, func(old interface{}) (interface{}, error) {
+				if oldItem, ok := old.(Item); !ok || !oldItem.alive(n) {
+					return nil, hafezieh.ErrMiss
+				}
+				return item, nil
+			})
+		}
+		if err == nil && !alive {
+			err = s.cache.Del(key)
+		}
+	case "cas":
+		atomicCache, ok := s.cache.(hafezieh.AtomicCache)
+		if !ok {
+			return serverError(hafezieh.ErrNotSupported), nil
+		}
+		cas, err := strconv.ParseUint(args[4], 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR " + errClient.Error(), nil
+		}
+		// The missing keys are reported as EXISTS too, since CompareAndSwap
+		// doesn't tell them apart
+		err = atomicCache.CompareAndSwap(key, item, cas, d)
+		if err == hafezieh.ErrCASConflict {
+			return "EXISTS", nil
+		}
+		if err == nil && !alive {
+			err = s.cache.Del(key)
+		}
+		if err != nil {
+			return serverError(err), nil
+		}
+		return "STORED", nil
+	}
+	switch err {
+	case nil:
+		return "STORED", nil
+	case hafezieh.ErrExists, hafezieh.ErrMiss:
+		return "NOT_STORED", nil
+	}
+	return serverError(err), nil
+}
+
+// remover is implemented by the caches which can tell if the deleted key was
+// available, like InMemoryCache
+type remover interface {
+	Remove(key string) (interface{}, error)
+}
+
+// delete replies DELETED for the caches which are not a remover, even if
+// the key is not available
+func (s *Server) delete(args []string) string {
+	if len(args) != 1 {
+		return "ERROR"
+	}
+	r, ok := s.cache.(remover)
+	if !ok {
+		if err := s.cache.Del(args[0]); err != nil {
+			return serverError(err)
+		}
+		return "DELETED"
+	}
+	x, err := r.Remove(args[0])
+	if err == hafezieh.ErrMiss {
+		return "NOT_FOUND"
+	}
+	if err != nil {
+		return serverError(err)
+	}
+	if item, ok := x.(Item); ok && !item.alive(time.Now()) {
+		return "NOT_FOUND"
+	}
+	return "DELETED"
+}
+
+var errNotFound = errors.New("not found")
+
+// incr runs incr and decr on the decimal values, like memcached. incr wraps
+// around at 64 bits, and decr stops at 0.
+func (s *Server) incr(args []string, decr bool) string {
+	if len(args) != 2 {
+		return "ERROR"
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR invalid numeric delta argument"
+	}
+	atomicCache, ok := s.cache.(hafezieh.AtomicCache)
+	if !ok {
+		return serverError(hafezieh.ErrNotSupported)
+	}
+	var result uint64
+	err = atomicCache.Update(args[0], func(old interface{}) (interface{}, error) {
+		item, ok := old.(Item)
+		if !ok || !item.alive(time.Now()) {
+			return nil, errNotFound
+		}
+		value, err := strconv.ParseUint(string(item.Value), 10, 64)
+		if err != nil {
+			return nil, hafezieh.ErrNotNumeric
+		}
+		switch {
+		case !decr:
+			value += delta
+		case delta > value:
+			value = 0
+		default:
+			value -= delta
+		}
+		result = value
+		item.Value = []byte(strconv.FormatUint(value, 10))
+		return item, nil
+	})
+	switch err {
+	case nil:
+		return strconv.FormatUint(result, 10)
+	case errNotFound:
+		return "NOT_FOUND"
+	case hafezieh.ErrNotNumeric:
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	}
+	return serverError(err)
+}
+
+func (s *Server) flush() string {
+	flusher, ok := s.cache.(hafezieh.Flusher)
+	if !ok {
+		return serverError(hafezieh.ErrNotSupported)
+	}
+	if err := flusher.Flush(); err != nil {
+		return serverError(err)
+	}
+	return "OK"
+}
+
+func (s *Server) keys(w *bufio.Writer, args []string) {
+	if len(args) > 1 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	lister, ok := s.cache.(hafezieh.KeyLister)
+	if !ok {
+		w.WriteString(serverError(hafezieh.ErrNotSupported) + "\r\n")
+		return
+	}
+	var prefix string
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+	keys, err := lister.Keys(prefix)
+	if err != nil {
+		w.WriteString(serverError(err) + "\r\n")
+		return
+	}
+	for _, key := range keys {
+		w.WriteString("KEY " + key + "\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+func (s *Server) delPrefix(args []string) string {
+	if len(args) != 1 {
+		return "ERROR"
+	}
+	deleter, ok := s.cache.(hafezieh.PrefixDeleter)
+	if !ok {
+		return serverError(hafezieh.ErrNotSupported)
+	}
+	n, err := deleter.DelPrefix(args[0])
+	if err != nil {
+		return serverError(err)
+	}
+	return "DELETED " + strconv.Itoa(n)
+}
+
+func (s *Server) stats(w *bufio.Writer) {
+	s.mutex.Lock()
+	conns := len(s.conns)
+	s.mutex.Unlock()
+	fmt.Fprintf(w, "STAT curr_connections %d\r\n", conns)
+	if c, ok := s.cache.(*inmemory.InMemoryCache); ok {
+		stats := c.Stats()
+		fmt.Fprintf(w, "STAT curr_items %d\r\n", stats.Items)
+		fmt.Fprintf(w, "STAT get_hits %d\r\n", stats.Hits)
+		fmt.Fprintf(w, "STAT get_misses %d\r\n", stats.Misses)
+	} else if sized, ok := s.cache.(hafezieh.SizedCache); ok {
+		fmt.Fprintf(w, "STAT curr_items %d\r\n", sized.Len())
+	}
+	w.WriteString("END\r\n")
+}
@@ -0,0 +1,244 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+// startServer serves a new InMemoryCache on a random port. stop should be
+// deferred by the caller.
+func startServer(t *testing.T) (s *Server, cache *inmemory.InMemoryCache, addr string, stop func()) {
+	c, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{
+		RevisitNumberOfWorkers: 1,
+		RevisitFunc:            ExpireRevisitFunc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = c.(*inmemory.InMemoryCache)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = NewServer(cache, nil)
+	go s.Serve(listener)
+	return s, cache, listener.Addr().String(), func() {
+		s.Shutdown(context.Background())
+		cache.Close()
+	}
+}
+
+type session struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *session {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &session{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// expect sends the request, and checks the reply lines
+func (s *session) expect(request string, reply ...string) {
+	s.t.Helper()
+	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := fmt.Fprint(s.conn, request); err != nil {
+		s.t.Fatal(err)
+	}
+	for _, want := range reply {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			s.t.Fatalf("%q: %v", request, err)
+		}
+		if got := strings.TrimSuffix(line, "\r\n"); got != want {
+			s.t.Fatalf("%q: unexpected reply %q, want %q", request, got, want)
+		}
+	}
+}
+
+func TestServerCommands(t *testing.T) {
+	_, cache, addr, stop := startServer(t)
+	defer stop()
+	s := dial(t, addr)
+	defer s.conn.Close()
+
+	s.expect("get a\r\n", "END")
+	s.expect("set a 5 0 3\r\nfoo\r\n", "STORED")
+	s.expect("get a b\r\n", "VALUE a 5 3", "foo", "END")
+	s.expect("add a 0 0 1\r\nx\r\n", "NOT_STORED")
+	s.expect("replace b 0 0 1\r\nx\r\n", "NOT_STORED")
+	s.expect("replace a 0 0 3\r\nbar\r\n", "STORED")
+
+	_, cas, err := cache.Gets("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expect("gets a\r\n", fmt.Sprintf("VALUE a 0 3 %d", cas), "bar", "END")
+	s.expect(fmt.Sprintf("cas a 0 0 3 %d\r\nbaz\r\n", cas+1), "EXISTS")
+	s.expect(fmt.Sprintf("cas a 0 0 3 %d\r\nbaz\r\n", cas), "STORED")
+	s.expect("cas b 0 0 3 1\r\nbaz\r\n", "EXISTS")
+
+	s.expect("set n 0 0 2\r\n10\r\n", "STORED")
+	s.expect("incr n 5\r\n", "15")
+	s.expect("decr n 20\r\n", "0")
+	s.expect("incr a 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	s.expect("incr b 1\r\n", "NOT_FOUND")
+
+	s.expect("set users:1 0 0 1\r\n1\r\n", "STORED")
+	s.expect("set users:2 0 0 1\r\n2\r\n", "STORED")
+	s.expect("keys users:\r\n", "KEY users:1", "KEY users:2", "END")
+	s.expect("delprefix users:\r\n", "DELETED 2")
+
+	hits := cache.Stats().Hits
+	s.expect("delete a\r\n", "DELETED")
+	s.expect("delete a noreply\r\ndelete a\r\n", "NOT_FOUND")
+	if cache.Stats().Hits != hits {
+		t.Fatal("expected delete not to be counted as a hit")
+	}
+	s.expect("set a 0 -1 1\r\nx\r\n", "STORED")
+	s.expect("get a\r\n", "END")
+
+	s.expect("set a 0 0 3\r\nfoobar\r\n", "CLIENT_ERROR bad data chunk")
+	s.expect("bogus\r\n", "ERROR")
+	s.expect("flush_all\r\n", "OK")
+	if cache.Len() != 0 {
+		t.Fatal("unexpected items after flush_all:", cache.Len())
+	}
+	s.expect("version\r\n", "VERSION hafezieh")
+	s.expect("stats\r\n", "STAT curr_connections 1", "STAT curr_items 0")
+}
+
+func TestServerSetsRevisit(t *testing.T) {
+	_, cache, addr, stop := startServer(t)
+	defer stop()
+	s := dial(t, addr)
+	defer s.conn.Close()
+
+	s.expect("set a 0 1 1\r\nx\r\n", "STORED")
+	item, err := cache.Inspect("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisitTime, _ := item.RevisitTime()
+	if d := revisitTime.Sub(time.Now()); d < 4*time.Second || d > inmemory.MinRevisitDuration {
+		t.Fatal("unexpected revisit duration:", d)
+	}
+	unix := time.Now().Add(time.Hour).Unix()
+	s.expect(fmt.Sprintf("set b 0 %d 1\r\nx\r\n", unix), "STORED")
+	item, _ = cache.Inspect("b")
+	if revisitTime, ok := item.RevisitTime(); !ok || revisitTime.Unix() != unix || item.Item.(Item).Expires.Unix() != unix {
+		t.Fatal("unexpected revisit time:", revisitTime, item.Item)
+	}
+}
+
+func TestServerExpiration(t *testing.T) {
+	_, cache, addr, stop := startServer(t)
+	defer stop()
+	s := dial(t, addr)
+	defer s.conn.Close()
+
+	s.expect("set a 0 1 1\r\nx\r\n", "STORED")
+	s.expect("set n 0 1 1\r\n1\r\n", "STORED")
+	s.expect("get a\r\n", "VALUE a 0 1", "x", "END")
+	time.Sleep(1100 * time.Millisecond)
+	// Available in the cache, until the revisit
+	if _, err := cache.Inspect("a"); err != nil {
+		t.Fatal(err)
+	}
+	s.expect("get a\r\n", "END")
+	s.expect("gets a\r\n", "END")
+	s.expect("incr n 1\r\n", "NOT_FOUND")
+	s.expect("delete n\r\n", "NOT_FOUND")
+	s.expect("replace a 0 0 1\r\ny\r\n", "NOT_STORED")
+	s.expect("add a 0 0 1\r\ny\r\n", "STORED")
+	s.expect("get a\r\n", "VALUE a 0 1", "y", "END")
+}
+
+func TestExpireRevisitFunc(t *testing.T) {
+	n := time.Now()
+	cases := []struct {
+		x    interface{}
+		want inmemory.RevisitAction
+	}{
+		{"foreign", inmemory.RevisitDelete},
+		{Item{}, inmemory.RevisitKeep},
+		{Item{Expires: n.Add(-time.Second)}, inmemory.RevisitDelete},
+		{Item{Expires: n.Add(time.Minute)}, inmemory.RevisitReschedule},
+	}
+	for _, c := range cases {
+		decision := ExpireRevisitFunc(nil, "key", &inmemory.InMemItem{Item: c.x})
+		if decision.Action != c.want {
+			t.Errorf("%v: unexpected action %v", c.x, decision.Action)
+		}
+		if decision.Action == inmemory.RevisitReschedule && decision.After < time.Minute {
+			t.Errorf("%v: rescheduled too early, after %v", c.x, decision.After)
+		}
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s, cache, addr, stop := startServer(t)
+	defer stop()
+	idle := dial(t, addr)
+	defer idle.conn.Close()
+	idle.expect("set a 0 0 1\r\nx\r\n", "STORED")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idle.r.ReadString('\n'); err == nil {
+		t.Fatal("expected the idle connection to be closed")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("expected the listener to be closed")
+	}
+	if x, err := cache.Get("a"); err != nil || string(x.(Item).Value) != "x" {
+		t.Fatal("unexpected item:", x, err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(listener); err != ErrServerClosed {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestServerNotSupported(t *testing.T) {
+	var cache hafezieh.Cache = plainCache{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(cache, nil)
+	go srv.Serve(listener)
+	defer srv.Shutdown(context.Background())
+
+	s := dial(t, listener.Addr().String())
+	defer s.conn.Close()
+	s.expect("add a 0 0 1\r\nx\r\n", "SERVER_ERROR not supported")
+	s.expect("flush_all\r\n", "SERVER_ERROR not supported")
+	s.expect("keys\r\n", "SERVER_ERROR not supported")
+}
+
+// plainCache implements nothing but hafezieh.Cache
+type plainCache struct{}
+
+func (plainCache) Set(string, interface{}, time.Duration) error { return nil }
+func (plainCache) Get(string) (interface{}, error)              { return nil, hafezieh.ErrMiss }
+func (plainCache) Del(string) error                             { return nil }
+func (plainCache) Close() error                                 { return nil }
@@ -0,0 +1,137 @@
+package memo
+
+import (
+	"crypto/sha1"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ErrUnhashable is returned for the arguments which can't be hashed, like
+// functions, channels and too deeply nested values
+var ErrUnhashable = errors.New("Unhashable argument")
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+
+// hashArgs returns a stable hash of the arguments, which only depends on
+// their types and values, e.g. not on the order of the keys of the maps or
+// the addresses of the pointers
+func hashArgs(args []interface{}) (string, error) {
+	h := sha1.New()
+	for _, arg := range args {
+		if err := hashValue(h, reflect.ValueOf(arg), 0); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// maxDepth stops the cyclic pointers
+const maxDepth = 32
+
+func writeUint(h hash.Hash, x uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], x)
+	h.Write(b[:])
+}
+
+func writeString(h hash.Hash, s string) {
+	writeUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+func hashValue(h hash.Hash, v reflect.Value, depth int) error {
+	if depth > maxDepth {
+		return ErrUnhashable
+	}
+	if !v.IsValid() {
+		writeString(h, "nil")
+		return nil
+	}
+	t := v.Type()
+	writeString(h, t.PkgPath()+"."+t.String())
+
+	if t.Implements(binaryMarshalerType) && v.CanInterface() &&
+		(v.Kind() != reflect.Ptr || !v.IsNil()) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		writeString(h, string(data))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			writeUint(h, 1)
+		} else {
+			writeUint(h, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeUint(h, math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		writeUint(h, math.Float64bits(real(v.Complex())))
+		writeUint(h, math.Float64bits(imag(v.Complex())))
+	case reflect.String:
+		writeString(h, v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			writeString(h, "nil")
+			return nil
+		}
+		return hashValue(h, v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			writeString(h, "nil")
+			return nil
+		}
+		writeUint(h, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := hashValue(h, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			writeString(h, "nil")
+			return nil
+		}
+		// The entries are hashed separately, and sorted by their hashes
+		entries := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			entry := sha1.New()
+			if err := hashValue(entry, key, depth+1); err != nil {
+				return err
+			}
+			if err := hashValue(entry, v.MapIndex(key), depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, string(entry.Sum(nil)))
+		}
+		sort.Strings(entries)
+		writeUint(h, uint64(len(entries)))
+		for _, entry := range entries {
+			h.Write([]byte(entry))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeString(h, t.Field(i).Name)
+			if err := hashValue(h, v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrUnhashable
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Package memo caches the results of functions in a hafezieh.Cache, by a
+// stable hash of their arguments.
+//
+//	findUser := memo.New(cache, "findUser", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+//		return db.FindUser(ctx, args[0].(int64))
+//	}, memo.WithTTL(time.Minute))
+//	user, err := findUser.Call(ctx, int64(42))
+package memo
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+// keyPrefix is the prefix of the keys of the results in the cache
+const keyPrefix = "memo:"
+
+// Func is a memoizable function. The context is not a part of the key.
+type Func func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+// errPanicked is returned to the callers waiting for a call which panicked
+var errPanicked = errors.New("memo: the function panicked")
+
+// negativeError wraps the errors stored in a hafezieh.NegativeCache, to tell
+// them apart from the failures of the cache
+type negativeError struct {
+	err error
+}
+
+func (e *negativeError) Error() string {
+	return e.err.Error()
+}
+
+// cachedError is stored for the errors, in the caches which are not a
+// hafezieh.NegativeCache
+type cachedError struct {
+	Message string
+}
+
+func init() {
+	gob.Register(cachedError{})
+}
+
+// Option configures the Memo returned by New
+type Option func(*Memo)
+
+// WithTTL sets the revisitDuration of the results. Default:
+// hafezieh.UseDefaultValue
+func WithTTL(ttl time.Duration) Option {
+	return func(m *Memo) {
+		m.ttl = ttl
+	}
+}
+
+// WithErrorTTL makes the errors of the function cached for ttl, which are
+// not cached by default. The context errors are never cached. In a
+// hafezieh.NegativeCache the errors are kept as they are, otherwise only
+// their messages are kept, and ttl is used as the revisitDuration.
+func WithErrorTTL(ttl time.Duration) Option {
+	return func(m *Memo) {
+		m.errorTTL = ttl
+		m.cacheErrors = true
+	}
+}
+
+// WithLogger sets the logger of the failed cache calls, which are discarded
+// by default
+func WithLogger(logger hafezieh.Logger) Option {
+	return func(m *Memo) {
+		m.logger = hafezieh.LoggerWith(logger)
+	}
+}
+
+// Memo is the cached version of a Func. The concurrent calls with the same
+// arguments which miss the cache are deduplicated, and share the result of
+// one call to the function, made by the context of the first caller.
+type Memo struct {
+	cache       hafezieh.Cache
+	name        string
+	fn          Func
+	ttl         time.Duration
+	errorTTL    time.Duration
+	cacheErrors bool
+	logger      hafezieh.Logger
+
+	mutex   sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a running call to the function
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// New returns the cached version of fn. name separates the keys of the
+// functions sharing the cache.
+func New(cache hafezieh.Cache, name string, fn Func, options ...Option) *Memo {
+	m := &Memo{
+		cache:   cache,
+		name:    name,
+		fn:      fn,
+		ttl:     hafezieh.UseDefaultValue,
+		logger:  hafezieh.NopLogger,
+		flights: make(map[string]*flight),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// Key returns the key of the result of the arguments in the cache
+func (m *Memo) Key(args ...interface{}) (string, error) {
+	hash, err := hashArgs(args)
+	if err != nil {
+		return "", err
+	}
+	return keyPrefix + m.name + ":" + hash, nil
+}
+
+// Call returns the cached result of the arguments, or calls the function and
+// caches its result. The arguments should be values of the basic types, or
+// the slices, arrays, maps, structs and pointers of them, otherwise
+// ErrUnhashable is returned.
+func (m *Memo) Call(ctx context.Context, args ...interface{}) (interface{}, error) {
+	key, err := m.Key(args...)
+	if err != nil {
+		return nil, err
+	}
+	x, err := m.cache.Get(key)
+	if err == nil {
+		if e, ok := x.(cachedError); ok {
+			return nil, errors.New(e.Message)
+		}
+		return x, nil
+	}
+	if e, ok := err.(*negativeError); ok {
+		return nil, e.err
+	}
+	if err != hafezieh.ErrMiss {
+		m.logger.Warn("memo lookup failed", "function", m.name, "error", err)
+	}
+
+	m.mutex.Lock()
+	f, found := m.flights[key]
+	if !found {
+		f = &flight{done: make(chan struct{})}
+		m.flights[key] = f
+		m.mutex.Unlock()
+		m.run(ctx, key, f, args)
+		return f.value, f.err
+	}
+	m.mutex.Unlock()
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run calls the function, caches the result, and finishes the flight
+func (m *Memo) run(ctx context.Context, key string, f *flight, args []interface{}) {
+	finished := false
+	defer func() {
+		if !finished {
+			f.value, f.err = nil, errPanicked
+		}
+		m.mutex.Lock()
+		delete(m.flights, key)
+		m.mutex.Unlock()
+		close(f.done)
+	}()
+	f.value, f.err = m.fn(ctx, args...)
+	finished = true
+	if f.err != nil {
+		// The context errors are of the caller, not of the arguments
+		if m.cacheErrors && !errors.Is(f.err, context.Canceled) && !errors.Is(f.err, context.DeadlineExceeded) {
+			m.storeError(key, f.err)
+		}
+		return
+	}
+	if err := m.cache.Set(key, f.value, m.ttl); err != nil {
+		m.logger.Warn("memo store failed", "function", m.name, "error", err)
+	}
+}
+
+func (m *Memo) storeError(key string, err error) {
+	if negativeCache, ok := m.cache.(hafezieh.NegativeCache); ok {
+		err = negativeCache.SetNegative(key, &negativeError{err: err}, m.errorTTL)
+	} else {
+		err = m.cache.Set(key, cachedError{Message: err.Error()}, m.errorTTL)
+	}
+	if err != nil {
+		m.logger.Warn("memo store failed", "function", m.name, "error", err)
+	}
+}
+
+// Forget deletes the cached result of the arguments
+func (m *Memo) Forget(args ...interface{}) error {
+	key, err := m.Key(args...)
+	if err != nil {
+		return err
+	}
+	return m.cache.Del(key)
+}
@@ -0,0 +1,228 @@
+package memo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"github.com/cafebazaar/hafezieh/memo"
+)
+
+type query struct {
+	Table  string
+	Filter map[string]interface{}
+	Limit  *int
+}
+
+func newCache(t *testing.T) hafezieh.Cache {
+	cache, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestCall(t *testing.T) {
+	cache := newCache(t)
+	defer cache.Close()
+	var calls int32
+	m := memo.New(cache, "count", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}, memo.WithTTL(time.Minute))
+
+	ten, twenty := 10, 20
+	if x, err := m.Call(context.Background(), "users", query{"users", map[string]interface{}{"a": 1, "b": "x"}, &ten}); err != nil || x != int32(1) {
+		t.Fatal("unexpected result:", x, err)
+	}
+	other := 10
+	if x, _ := m.Call(context.Background(), "users", query{"users", map[string]interface{}{"b": "x", "a": 1}, &other}); x != int32(1) {
+		t.Fatal("expected equal arguments to share the result, got", x)
+	}
+	if x, _ := m.Call(context.Background(), "users", query{"users", map[string]interface{}{"b": "x", "a": 1}, &twenty}); x != int32(2) {
+		t.Fatal("expected different arguments to be called, got", x)
+	}
+	if x, _ := m.Call(context.Background(), "users", int64(1)); x != int32(3) {
+		t.Fatal("expected different types to be called, got", x)
+	}
+	if x, _ := m.Call(context.Background(), "users", int32(1)); x != int32(4) {
+		t.Fatal("expected different types to be called, got", x)
+	}
+	if x, _ := m.Call(context.Background(), "users", int64(1)); x != int32(3) {
+		t.Fatal("unexpected cached result:", x)
+	}
+
+	if err := m.Forget("users", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := m.Call(context.Background(), "users", int64(1)); x != int32(5) {
+		t.Fatal("expected a forgotten result to be called, got", x)
+	}
+	if _, err := m.Call(context.Background(), func() {}); err != memo.ErrUnhashable {
+		t.Fatal("expected ErrUnhashable, got", err)
+	}
+
+	k1, _ := memo.New(cache, "a", nil).Key(1)
+	k2, _ := memo.New(cache, "b", nil).Key(1)
+	if k1 == k2 {
+		t.Fatal("expected the functions to have separate keys")
+	}
+}
+
+func TestSingleFlight(t *testing.T) {
+	cache := newCache(t)
+	defer cache.Close()
+	var calls int32
+	release := make(chan struct{})
+	m := memo.New(cache, "slow", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return args[0], nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = m.Call(context.Background(), "x")
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Fatal("expected a single call, got", calls)
+	}
+	for _, x := range results {
+		if x != "x" {
+			t.Fatal("unexpected result:", x)
+		}
+	}
+}
+
+func TestWaitingCallerContext(t *testing.T) {
+	cache := newCache(t)
+	defer cache.Close()
+	release := make(chan struct{})
+	m := memo.New(cache, "slow", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	done := make(chan struct{})
+	go func() {
+		m.Call(context.Background())
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := m.Call(ctx); err != context.DeadlineExceeded {
+		t.Fatal("expected DeadlineExceeded, got", err)
+	}
+	close(release)
+	<-done
+}
+
+func TestErrors(t *testing.T) {
+	errNotFound := errors.New("not found")
+	for name, cache := range map[string]hafezieh.Cache{
+		"negative": newCache(t),
+		"plain":    &mapCache{items: map[string]interface{}{}},
+	} {
+		var calls int32
+		fn := func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errNotFound
+		}
+
+		m := memo.New(cache, "uncached", fn)
+		m.Call(context.Background(), 1)
+		if _, err := m.Call(context.Background(), 1); err != errNotFound || calls != 2 {
+			t.Fatal(name, "expected the errors not to be cached:", err, calls)
+		}
+
+		calls = 0
+		m = memo.New(cache, "cached", fn, memo.WithErrorTTL(time.Minute))
+		m.Call(context.Background(), 1)
+		_, err := m.Call(context.Background(), 1)
+		if err == nil || err.Error() != errNotFound.Error() || calls != 1 {
+			t.Fatal(name, "expected the error to be cached:", err, calls)
+		}
+		if name == "negative" && err != errNotFound {
+			t.Fatal("expected the error to be kept by a NegativeCache, got", err)
+		}
+		cache.Close()
+	}
+}
+
+func TestErrorsNotCached(t *testing.T) {
+	d := newCache(t)
+	defer d.Close()
+	cache := d.(*inmemory.InMemoryCache)
+	var calls int32
+	m := memo.New(cache, "f", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+		return "ok", nil
+	}, memo.WithErrorTTL(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Call(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected Canceled, got", err)
+	}
+	if x, err := m.Call(context.Background(), 1); err != nil || x != "ok" {
+		t.Fatal("expected the context error not to be cached, got", x, err)
+	}
+
+	// Not set by the Memo, like a failure of the cache
+	key, _ := m.Key(2)
+	cache.SetNegative(key, errors.New("unavailable"), time.Minute)
+	if x, err := m.Call(context.Background(), 2); err != nil || x != "ok" {
+		t.Fatal("expected the function to be called, got", x, err)
+	}
+	if calls != 3 {
+		t.Fatal("unexpected calls:", calls)
+	}
+}
+
+// mapCache is a plain hafezieh.Cache, which isn't a NegativeCache
+type mapCache struct {
+	mutex sync.Mutex
+	items map[string]interface{}
+}
+
+func (c *mapCache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items[key] = x
+	return nil
+}
+
+func (c *mapCache) Get(key string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	x, found := c.items[key]
+	if !found {
+		return nil, hafezieh.ErrMiss
+	}
+	return x, nil
+}
+
+func (c *mapCache) Del(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.items, key)
+	return nil
+}
+
+func (c *mapCache) Close() error { return nil }
@@ -0,0 +1,116 @@
+// Package middleware decorates the cache engines with the cross-cutting
+// concerns, like key prefixing or logging, so the engines only deal with the
+// storage.
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+)
+
+var (
+	// ErrReadOnly is the error returned by Set and Del of a ReadOnly cache
+	ErrReadOnly = errors.New("Cache is read-only")
+)
+
+// Middleware wraps a cache, and returns the decorated one
+type Middleware func(hafezieh.Cache) hafezieh.Cache
+
+// Chain combines the middlewares into one. The first middleware is the
+// outermost, so Chain(a, b)(cache) is a(b(cache)).
+func Chain(middlewares ...Middleware) Middleware {
+	return func(cache hafezieh.Cache) hafezieh.Cache {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			cache = middlewares[i](cache)
+		}
+		return cache
+	}
+}
+
+// Prefix adds prefix to the keys, so the caches sharing an engine don't
+// collide. See hafezieh.Prefixed.
+func Prefix(prefix string) Middleware {
+	return func(cache hafezieh.Cache) hafezieh.Cache {
+		return hafezieh.Prefixed(cache, prefix)
+	}
+}
+
+type readOnlyCache struct {
+	hafezieh.Cache
+}
+
+// Unwrap returns the wrapped cache
+func (c *readOnlyCache) Unwrap() hafezieh.Cache {
+	return c.Cache
+}
+
+func (c *readOnlyCache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	return ErrReadOnly
+}
+
+func (c *readOnlyCache) Del(key string) error {
+	return ErrReadOnly
+}
+
+// ReadOnly makes Set and Del return ErrReadOnly, without calling the cache
+func ReadOnly() Middleware {
+	return func(cache hafezieh.Cache) hafezieh.Cache {
+		return &readOnlyCache{Cache: cache}
+	}
+}
+
+type latencyCache struct {
+	hafezieh.Cache
+	logger    hafezieh.Logger
+	threshold time.Duration
+}
+
+// Unwrap returns the wrapped cache
+func (c *latencyCache) Unwrap() hafezieh.Cache {
+	return c.Cache
+}
+
+func (c *latencyCache) log(operation, key string, start time.Time, err error) {
+	duration := time.Since(start)
+	if duration < c.threshold {
+		return
+	}
+	if err != nil && err != hafezieh.ErrMiss {
+		c.logger.Warn("slow cache call", "operation", operation, "key", key, "duration", duration, "error", err)
+		return
+	}
+	c.logger.Warn("slow cache call", "operation", operation, "key", key, "duration", duration)
+}
+
+func (c *latencyCache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	start := time.Now()
+	err := c.Cache.Set(key, x, revisitDuration)
+	c.log("Set", key, start, err)
+	return err
+}
+
+func (c *latencyCache) Get(key string) (interface{}, error) {
+	start := time.Now()
+	x, err := c.Cache.Get(key)
+	c.log("Get", key, start, err)
+	return x, err
+}
+
+func (c *latencyCache) Del(key string) error {
+	start := time.Now()
+	err := c.Cache.Del(key)
+	c.log("Del", key, start, err)
+	return err
+}
+
+// LogLatency logs the calls which take at least threshold, with their
+// operation, key, duration and error (a miss is not an error). A zero
+// threshold logs all the calls.
+func LogLatency(logger hafezieh.Logger, threshold time.Duration) Middleware {
+	logger = hafezieh.LoggerWith(logger)
+	return func(cache hafezieh.Cache) hafezieh.Cache {
+		return &latencyCache{Cache: cache, logger: logger, threshold: threshold}
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+)
+
+func newCache(t *testing.T) hafezieh.Cache {
+	cache, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(cache hafezieh.Cache) hafezieh.Cache {
+			order = append(order, name)
+			return cache
+		}
+	}
+	Chain(mark("outer"), mark("inner"))(newCache(t))
+	if strings.Join(order, ",") != "inner,outer" {
+		t.Fatal("unexpected order of wrapping:", order)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	base := newCache(t)
+	users := Prefix("users:")(base)
+	if err := users.Set("1", "hafez", 0); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := base.Get("users:1"); err != nil || x != "hafez" {
+		t.Fatal("the key isn't prefixed:", x, err)
+	}
+	if x, err := users.Get("1"); err != nil || x != "hafez" {
+		t.Fatal("unexpected Get result:", x, err)
+	}
+	base.Set("posts:1", "post", 0)
+	if keys, err := users.(hafezieh.KeyLister).Keys(""); err != nil || len(keys) != 1 || keys[0] != "1" {
+		t.Fatal("unexpected keys:", keys, err)
+	}
+	if err := users.Del("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Get("users:1"); err != hafezieh.ErrMiss {
+		t.Fatal("the prefixed key isn't deleted:", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	base := newCache(t)
+	base.Set("a", 1, 0)
+	c := ReadOnly()(base)
+	if err := c.Set("b", 2, 0); err != ErrReadOnly {
+		t.Fatal("expecting ErrReadOnly, got:", err)
+	}
+	if err := c.Del("a"); err != ErrReadOnly {
+		t.Fatal("expecting ErrReadOnly, got:", err)
+	}
+	if x, err := c.Get("a"); err != nil || x != 1 {
+		t.Fatal("unexpected Get result:", x, err)
+	}
+}
+
+func TestLogLatency(t *testing.T) {
+	var buf bytes.Buffer
+	logger := hafezieh.NewStdLogger(log.New(&buf, "", 0), false)
+	c := Chain(LogLatency(logger, 0), ReadOnly())(newCache(t))
+	c.Get("a")
+	c.Set("a", 1, 0)
+	logs := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(logs) != 2 {
+		t.Fatalf("unexpected logs: %q", logs)
+	}
+	if !strings.HasPrefix(logs[0], "WARN slow cache call operation=Get key=a duration=") ||
+		strings.Contains(logs[0], "error=") {
+		t.Fatalf("unexpected Get log: %q", logs[0])
+	}
+	if !strings.HasPrefix(logs[1], "WARN slow cache call operation=Set key=a duration=") ||
+		!strings.HasSuffix(logs[1], "error="+ErrReadOnly.Error()) {
+		t.Fatalf("unexpected Set log: %q", logs[1])
+	}
+
+	buf.Reset()
+	LogLatency(logger, time.Hour)(newCache(t)).Get("a")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected log of a fast call: %q", buf.String())
+	}
+}
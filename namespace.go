@@ -0,0 +1,94 @@
+package hafezieh
+
+import (
+	"strings"
+	"time"
+)
+
+// NamespaceSeparator separates the name of a namespace from the keys
+const NamespaceSeparator = ":"
+
+// NamespacePrefix returns the prefix of the keys of the namespace in the
+// underlying cache
+func NamespacePrefix(name string) string {
+	return name + NamespaceSeparator
+}
+
+type prefixCache struct {
+	cache  Cache
+	prefix string
+}
+
+// Prefixed returns a view of cache, which adds prefix to the keys. The view
+// is a Flusher, a PrefixDeleter and a KeyLister, which only deal with the
+// keys starting with prefix, and return ErrNotSupported if cache isn't a
+// PrefixDeleter or a KeyLister. Closing the view closes cache.
+func Prefixed(cache Cache, prefix string) Cache {
+	return &prefixCache{cache: cache, prefix: prefix}
+}
+
+// Unwrap returns the underlying cache
+func (c *prefixCache) Unwrap() Cache {
+	return c.cache
+}
+
+func (c *prefixCache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.cache.Set(c.prefix+key, x, revisitDuration)
+}
+
+func (c *prefixCache) Get(key string) (interface{}, error) {
+	return c.cache.Get(c.prefix + key)
+}
+
+func (c *prefixCache) Del(key string) error {
+	return c.cache.Del(c.prefix + key)
+}
+
+func (c *prefixCache) Close() error {
+	return c.cache.Close()
+}
+
+// Flush deletes the keys starting with the prefix
+func (c *prefixCache) Flush() error {
+	_, err := c.DelPrefix("")
+	return err
+}
+
+func (c *prefixCache) DelPrefix(prefix string) (int, error) {
+	deleter, ok := c.cache.(PrefixDeleter)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return deleter.DelPrefix(c.prefix + prefix)
+}
+
+func (c *prefixCache) Keys(prefix string) ([]string, error) {
+	lister, ok := c.cache.(KeyLister)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	keys, err := lister.Keys(c.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], c.prefix)
+	}
+	return keys, nil
+}
+
+type namespaceCache struct {
+	*prefixCache
+}
+
+// Namespace returns a Prefixed view of cache by NamespacePrefix(name), so the
+// users of a shared cache don't collide. Closing the view doesn't close
+// cache.
+func Namespace(cache Cache, name string) Cache {
+	return namespaceCache{&prefixCache{cache: cache, prefix: NamespacePrefix(name)}}
+}
+
+// Close does nothing, as the underlying cache may be used by the others
+func (c namespaceCache) Close() error {
+	return nil
+}
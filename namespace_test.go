@@ -0,0 +1,94 @@
+package hafezieh
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mapCache map[string]interface{}
+
+func (c mapCache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	c[key] = x
+	return nil
+}
+
+func (c mapCache) Get(key string) (interface{}, error) {
+	if x, found := c[key]; found {
+		return x, nil
+	}
+	return nil, ErrMiss
+}
+
+func (c mapCache) Del(key string) error {
+	delete(c, key)
+	return nil
+}
+
+func (c mapCache) Close() error { return nil }
+
+func (c mapCache) DelPrefix(prefix string) (int, error) {
+	n := 0
+	for key := range c {
+		if strings.HasPrefix(key, prefix) {
+			delete(c, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c mapCache) Keys(prefix string) ([]string, error) {
+	keys := []string{}
+	for key := range c {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+type plainCache struct {
+	Cache
+}
+
+func TestNamespace(t *testing.T) {
+	shared := mapCache{}
+	billing := Namespace(shared, "billing")
+	users := Namespace(shared, "users")
+	billing.Set("user:1", "b", 0)
+	billing.Set("user:2", "b", 0)
+	users.Set("user:1", "u", 0)
+
+	if x, err := billing.Get("user:1"); err != nil || x != "b" {
+		t.Fatal("unexpected Get result:", x, err)
+	}
+	if x, err := shared.Get("users:user:1"); err != nil || x != "u" {
+		t.Fatal("the key isn't prefixed:", x, err)
+	}
+	keys, err := billing.(KeyLister).Keys("user:")
+	if err != nil || !reflect.DeepEqual(keys, []string{"user:1", "user:2"}) {
+		t.Fatal("unexpected keys:", keys, err)
+	}
+
+	if err := billing.(Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(shared) != 1 {
+		t.Fatal("unexpected keys after Flush:", shared)
+	}
+	if _, err := users.Get("user:1"); err != nil {
+		t.Fatal("the other namespace is flushed:", err)
+	}
+	if err := users.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := Namespace(plainCache{mapCache{}}, "plain")
+	if err := plain.(Flusher).Flush(); err != ErrNotSupported {
+		t.Fatal("expecting ErrNotSupported, got:", err)
+	}
+}
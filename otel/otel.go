@@ -0,0 +1,207 @@
+// Package otel instruments the cache engines with OpenTelemetry. Each call
+// becomes a span, and is counted and timed by the metrics.
+package otel
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/cafebazaar/hafezieh/otel"
+
+// Attribute keys of the spans and the metrics
+const (
+	EngineKey    = attribute.Key("cache.engine")
+	OperationKey = attribute.Key("cache.operation")
+	KeyHashKey   = attribute.Key("cache.key.hash")
+	HitKey       = attribute.Key("cache.hit")
+	ValueSizeKey = attribute.Key("cache.value.size")
+	ResultKey    = attribute.Key("cache.result")
+)
+
+// Option configures the Cache returned by New
+type Option func(*Cache)
+
+// WithTracerProvider sets the TracerProvider of the spans, instead of the
+// global one
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *Cache) {
+		c.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// WithMeterProvider sets the MeterProvider of the metrics, instead of the
+// global one
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *Cache) {
+		c.meter = provider.Meter(instrumentationName)
+	}
+}
+
+// WithEngine sets the cache.engine attribute, which is the type of the
+// wrapped cache by default
+func WithEngine(engine string) Option {
+	return func(c *Cache) {
+		c.engine = attribute.String(string(EngineKey), engine)
+	}
+}
+
+// Cache wraps a hafezieh.Cache, and instruments its calls. The methods of
+// hafezieh.Cache start root spans, and the *Context variants start the spans
+// as children of the span of ctx.
+type Cache struct {
+	cache    hafezieh.Cache
+	engine   attribute.KeyValue
+	tracer   trace.Tracer
+	meter    metric.Meter
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// New returns cache, instrumented
+func New(cache hafezieh.Cache, options ...Option) (*Cache, error) {
+	c := &Cache{
+		cache:  cache,
+		engine: attribute.String(string(EngineKey), fmt.Sprintf("%T", cache)),
+		tracer: otel.GetTracerProvider().Tracer(instrumentationName),
+		meter:  otel.GetMeterProvider().Meter(instrumentationName),
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	var err error
+	c.requests, err = c.meter.Int64Counter("hafezieh.cache.requests",
+		metric.WithDescription("Number of the cache calls, by operation and result"))
+	if err != nil {
+		return nil, err
+	}
+	c.duration, err = c.meter.Float64Histogram("hafezieh.cache.duration",
+		metric.WithDescription("Duration of the cache calls"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Unwrap returns the wrapped cache
+func (c *Cache) Unwrap() hafezieh.Cache {
+	return c.cache
+}
+
+func (c *Cache) Set(key string, x interface{}, revisitDuration time.Duration) error {
+	return c.SetContext(context.Background(), key, x, revisitDuration)
+}
+
+func (c *Cache) Get(key string) (interface{}, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+func (c *Cache) Del(key string) error {
+	return c.DelContext(context.Background(), key)
+}
+
+func (c *Cache) Close() error {
+	op := c.start(context.Background(), "Close")
+	err := c.cache.Close()
+	op.end(err)
+	return err
+}
+
+// SetContext is like Set, and its span is a child of the span of ctx
+func (c *Cache) SetContext(ctx context.Context, key string, x interface{}, revisitDuration time.Duration) error {
+	op := c.start(ctx, "Set", hashKey(key))
+	if size, ok := valueSize(x); ok {
+		op.span.SetAttributes(ValueSizeKey.Int(size))
+	}
+	err := c.cache.Set(key, x, revisitDuration)
+	op.end(err)
+	return err
+}
+
+// GetContext is like Get, and its span is a child of the span of ctx
+func (c *Cache) GetContext(ctx context.Context, key string) (interface{}, error) {
+	op := c.start(ctx, "Get", hashKey(key))
+	x, err := c.cache.Get(key)
+	op.span.SetAttributes(HitKey.Bool(err == nil))
+	if err == nil {
+		if size, ok := valueSize(x); ok {
+			op.span.SetAttributes(ValueSizeKey.Int(size))
+		}
+	}
+	op.end(err)
+	return x, err
+}
+
+// DelContext is like Del, and its span is a child of the span of ctx
+func (c *Cache) DelContext(ctx context.Context, key string) error {
+	op := c.start(ctx, "Del", hashKey(key))
+	err := c.cache.Del(key)
+	op.end(err)
+	return err
+}
+
+type operation struct {
+	cache *Cache
+	ctx   context.Context
+	name  string
+	span  trace.Span
+	start time.Time
+}
+
+func (c *Cache) start(ctx context.Context, name string, attributes ...attribute.KeyValue) *operation {
+	attributes = append(attributes, c.engine, OperationKey.String(name))
+	ctx, span := c.tracer.Start(ctx, "hafezieh."+name,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	return &operation{cache: c, ctx: ctx, name: name, span: span, start: time.Now()}
+}
+
+// end ends the span, and records the metrics. ErrMiss is not an error.
+func (op *operation) end(err error) {
+	result := "ok"
+	switch {
+	case err == hafezieh.ErrMiss:
+		result = "miss"
+	case err != nil:
+		result = "error"
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	case op.name == "Get":
+		result = "hit"
+	}
+	op.span.SetAttributes(ResultKey.String(result))
+	op.span.End()
+
+	attributes := metric.WithAttributes(op.cache.engine, OperationKey.String(op.name), ResultKey.String(result))
+	op.cache.requests.Add(op.ctx, 1, attributes)
+	op.cache.duration.Record(op.ctx, time.Since(op.start).Seconds(), attributes)
+}
+
+// hashKey returns the attribute of the hashed key, so the keys, which may
+// contain personal data, aren't exported
+func hashKey(key string) attribute.KeyValue {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return KeyHashKey.String(strconv.FormatUint(h.Sum64(), 16))
+}
+
+// valueSize returns the size of the strings and the byte slices
+func valueSize(x interface{}) (int, bool) {
+	switch v := x.(type) {
+	case []byte:
+		return len(v), true
+	case string:
+		return len(v), true
+	}
+	return 0, false
+}
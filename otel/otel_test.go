@@ -0,0 +1,108 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cafebazaar/hafezieh"
+	"github.com/cafebazaar/hafezieh/inmemory"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestCache(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	inner, err := inmemory.NewMemoryCache(&inmemory.InMemoryCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(inner, WithTracerProvider(tracerProvider), WithMeterProvider(meterProvider), WithEngine("inmemory"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "parent")
+	if err := c.SetContext(ctx, "user:1", "hafez", 0); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := c.GetContext(ctx, "user:1"); err != nil || x != "hafez" {
+		t.Fatal("unexpected Get result:", x, err)
+	}
+	parent.End()
+	if _, err := c.Get("user:2"); err != hafezieh.ErrMiss {
+		t.Fatal("expecting a miss, got:", err)
+	}
+	c.Close()
+	if err := c.Set("user:3", 3, time.Minute); err != hafezieh.ErrClosed {
+		t.Fatal("expecting ErrClosed, got:", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 6 {
+		t.Fatal("unexpected number of spans:", len(spans))
+	}
+	set, get, parentSpan, miss, closed := spans[0], spans[1], spans[2], spans[3], spans[5]
+	if set.Name != "hafezieh.Set" || set.Parent.SpanID() != parentSpan.SpanContext.SpanID() {
+		t.Fatal("unexpected Set span:", set.Name, set.Parent)
+	}
+	if v, _ := spanAttribute(set, ValueSizeKey); v.AsInt64() != 5 {
+		t.Fatal("unexpected value size:", v.Emit())
+	}
+	if v, _ := spanAttribute(set, KeyHashKey); v.AsString() == "" || v.AsString() == "user:1" {
+		t.Fatal("unexpected key hash:", v.Emit())
+	}
+	if v, _ := spanAttribute(set, EngineKey); v.AsString() != "inmemory" {
+		t.Fatal("unexpected engine:", v.Emit())
+	}
+	if v, _ := spanAttribute(get, HitKey); !v.AsBool() {
+		t.Fatal("expecting a hit")
+	}
+	if v, _ := spanAttribute(miss, HitKey); v.AsBool() || miss.Status.Code == codes.Error {
+		t.Fatal("unexpected miss span:", miss.Attributes, miss.Status)
+	}
+	if closed.Status.Code != codes.Error || len(closed.Events) != 1 {
+		t.Fatal("the error isn't recorded:", closed.Status)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "hafezieh.cache.requests" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				op, _ := dp.Attributes.Value(OperationKey)
+				result, _ := dp.Attributes.Value(ResultKey)
+				results[op.AsString()+":"+result.AsString()] += dp.Value
+			}
+		}
+	}
+	expected := map[string]int64{"Set:ok": 1, "Get:hit": 1, "Get:miss": 1, "Close:ok": 1, "Set:error": 1}
+	for k, v := range expected {
+		if results[k] != v {
+			t.Fatal("unexpected requests metric:", results)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package hafezieh
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Factory builds a cache from the URL passed to Open. The options of the
+// engine are usually passed in the query of the URL.
+type Factory func(u *url.URL) (Cache, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = make(map[string]Factory)
+)
+
+// Register makes the engine available by the scheme to Open. The engines
+// register themselves in their init, so they should be imported (maybe with
+// the blank identifier) before calling Open. It panics if factory is nil, or
+// the scheme is already registered.
+func Register(scheme string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	if factory == nil {
+		panic("hafezieh: Register factory is nil")
+	}
+	if _, found := factories[scheme]; found {
+		panic("hafezieh: Register called twice for scheme " + scheme)
+	}
+	factories[scheme] = factory
+}
+
+// Schemes returns the sorted list of the registered schemes
+func Schemes() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open builds a cache by the factory registered for the scheme of rawurl,
+// like "inmemory://?number-target=10000&revisit-default-duration=5m"
+func Open(rawurl string) (Cache, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	factoriesMutex.RLock()
+	factory, found := factories[u.Scheme]
+	factoriesMutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("hafezieh: unknown scheme %q (forgotten import?)", u.Scheme)
+	}
+	return factory(u)
+}
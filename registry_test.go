@@ -0,0 +1,52 @@
+package hafezieh
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+type registryTestCache struct {
+	Cache
+	u *url.URL
+}
+
+var registryTestRuns int
+
+func TestRegistry(t *testing.T) {
+	// Each run registers a new scheme, as the registered ones can't be removed
+	registryTestRuns++
+	scheme := fmt.Sprintf("registry-test-%d", registryTestRuns)
+	Register(scheme, func(u *url.URL) (Cache, error) {
+		return &registryTestCache{u: u}, nil
+	})
+
+	found := false
+	for _, s := range Schemes() {
+		if s == scheme {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal(scheme, "is not in Schemes:", Schemes())
+	}
+
+	c, err := Open(scheme + "://host/?a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := c.(*registryTestCache).u; u.Host != "host" || u.Query().Get("a") != "1" {
+		t.Fatal("unexpected url:", u)
+	}
+
+	if _, err := Open("registry-unknown://"); err == nil {
+		t.Fatal("expecting an error for an unknown scheme")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expecting a panic on registering a scheme twice")
+		}
+	}()
+	Register(scheme, func(u *url.URL) (Cache, error) { return nil, nil })
+}
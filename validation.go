@@ -0,0 +1,34 @@
+package hafezieh
+
+import "strings"
+
+// ValidationErrors aggregates all the problems of a config, so they can be
+// fixed at once
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Append adds err to e, flattening it if it's a ValidationErrors too
+func (e ValidationErrors) Append(err error) ValidationErrors {
+	if err == nil {
+		return e
+	}
+	if errs, ok := err.(ValidationErrors); ok {
+		return append(e, errs...)
+	}
+	return append(e, err)
+}
+
+// Err returns nil if e is empty, otherwise e
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}